@@ -3,12 +3,27 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 var (
 	GEMINI_API_KEY = ""
+
+	// STT_WORKERS is the number of files processed concurrently. whisper
+	// still decodes one file at a time; extra workers only overlap ffmpeg
+	// and file I/O with it
+	STT_WORKERS = 1
+
+	// STT_MODEL_MIRROR and STT_MODEL_BUNDLE override where whisper models
+	// are downloaded from, see utils.ModelSource
+	STT_MODEL_MIRROR = ""
+	STT_MODEL_BUNDLE = ""
+
+	// STT_DECODE holds whisper decoding settings for every job, in the
+	// format of stt.ParseDecodeOptions
+	STT_DECODE = ""
 )
 
 func LoadEnv(log *log.Logger) {
@@ -20,6 +35,17 @@ func LoadEnv(log *log.Logger) {
 		log.Fatal("[ERROR] GEMINI_API_KEY not set in environment")
 	}
 
+	if v := os.Getenv("STT_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("[ERROR] STT_WORKERS must be a positive integer, got %q", v)
+		}
+		STT_WORKERS = n
+	}
+
+	STT_MODEL_MIRROR = os.Getenv("STT_MODEL_MIRROR")
+	STT_MODEL_BUNDLE = os.Getenv("STT_MODEL_BUNDLE")
+	STT_DECODE = os.Getenv("STT_DECODE")
 
 	log.Println("ENV loaded successfully")
 }
@@ -10,6 +10,32 @@ type SegmentResult struct {
 	Start time.Duration `json:"start"`
 	End   time.Duration `json:"end"`
 	Text  string        `json:"text"`
+
+	// RawText is whisper's text before glossary replacement and
+	// post-processing, set only when one of them ran
+	RawText string `json:"raw_text,omitempty"`
+
+	// Speaker is the diarization label, e.g. "SPEAKER_1", if diarization ran
+	Speaker string `json:"speaker,omitempty"`
+
+	// Words is only filled when word timestamps were requested
+	Words []Word `json:"words,omitempty"`
+
+	// AvgProbability and MinProbability summarize the probabilities of the
+	// segment's text tokens
+	AvgProbability float32 `json:"avg_probability,omitempty"`
+	MinProbability float32 `json:"min_probability,omitempty"`
+
+	// Review marks segments below the review threshold for a human check
+	Review bool `json:"review,omitempty"`
+}
+
+// Word is a single word of a segment with its own timing
+type Word struct {
+	Text        string        `json:"text"`
+	Start       time.Duration `json:"start"`
+	End         time.Duration `json:"end"`
+	Probability float32       `json:"probability"`
 }
 
 
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TranscriptVersion is the version of the transcript document format
+// written by this build:
+//
+//	0: a bare array of segments, times in nanoseconds
+//	1: an object with language and segments, times in nanoseconds
+//	2: adds source, model, options and creation time; times are written in
+//	   milliseconds and as "HH:MM:SS.mmm"
+const TranscriptVersion = 2
+
+// Transcript is the content of a transcript file in stt/
+type Transcript struct {
+	// Source describes the media the transcript was made from
+	Source TranscriptSource
+
+	// Model is the whisper model that produced the transcript
+	Model string
+
+	// Options are the settings that shaped the transcript, as JSON
+	Options json.RawMessage
+
+	// CreatedAt is when the transcript was written
+	CreatedAt time.Time
+
+	// Language is the ISO code whisper decoded with, either requested or detected
+	Language string
+
+	// LanguageProbability is only set when the language was auto-detected
+	LanguageProbability float32
+
+	// Translated marks segments that were translated to English from Language
+	Translated bool
+
+	Segments []SegmentResult
+
+	// Version is the format the transcript was read from; it is always
+	// written as TranscriptVersion
+	Version int
+}
+
+// TranscriptSource identifies the media file of a transcript
+type TranscriptSource struct {
+	Path     string
+	SHA256   string
+	Duration time.Duration
+}
+
+// transcriptDocument is the JSON of a version 2 transcript
+type transcriptDocument struct {
+	Version             int               `json:"version"`
+	Source              *sourceDocument   `json:"source,omitempty"`
+	Model               string            `json:"model,omitempty"`
+	Options             json.RawMessage   `json:"options,omitempty"`
+	CreatedAt           *time.Time        `json:"created_at,omitempty"`
+	Language            string            `json:"language,omitempty"`
+	LanguageProbability float32           `json:"language_probability,omitempty"`
+	Translated          bool              `json:"translated,omitempty"`
+	Segments            []segmentDocument `json:"segments"`
+}
+
+type sourceDocument struct {
+	Path       string `json:"path"`
+	SHA256     string `json:"sha256,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Duration   string `json:"duration,omitempty"`
+}
+
+type segmentDocument struct {
+	StartMs        int64          `json:"start_ms"`
+	EndMs          int64          `json:"end_ms"`
+	Start          string         `json:"start"`
+	End            string         `json:"end"`
+	Text           string         `json:"text"`
+	RawText        string         `json:"raw_text,omitempty"`
+	Speaker        string         `json:"speaker,omitempty"`
+	Words          []wordDocument `json:"words,omitempty"`
+	AvgProbability float32        `json:"avg_probability,omitempty"`
+	MinProbability float32        `json:"min_probability,omitempty"`
+	Review         bool           `json:"review,omitempty"`
+}
+
+type wordDocument struct {
+	Text        string  `json:"text"`
+	StartMs     int64   `json:"start_ms"`
+	EndMs       int64   `json:"end_ms"`
+	Probability float32 `json:"probability"`
+}
+
+// legacyTranscript is the JSON of a version 1 transcript
+type legacyTranscript struct {
+	Language            string          `json:"language"`
+	LanguageProbability float32         `json:"language_probability"`
+	Translated          bool            `json:"translated"`
+	Segments            []SegmentResult `json:"segments"`
+}
+
+// MarshalJSON writes the transcript as a TranscriptVersion document.
+func (t Transcript) MarshalJSON() ([]byte, error) {
+	doc := transcriptDocument{
+		Version:             TranscriptVersion,
+		Model:               t.Model,
+		Options:             t.Options,
+		Language:            t.Language,
+		LanguageProbability: t.LanguageProbability,
+		Translated:          t.Translated,
+		Segments:            make([]segmentDocument, len(t.Segments)),
+	}
+	if t.Source != (TranscriptSource{}) {
+		doc.Source = &sourceDocument{Path: t.Source.Path, SHA256: t.Source.SHA256}
+		if t.Source.Duration > 0 {
+			doc.Source.DurationMs = t.Source.Duration.Milliseconds()
+			doc.Source.Duration = Timestamp(t.Source.Duration)
+		}
+	}
+	if !t.CreatedAt.IsZero() {
+		created := t.CreatedAt.UTC()
+		doc.CreatedAt = &created
+	}
+	for i, seg := range t.Segments {
+		s := segmentDocument{
+			StartMs:        seg.Start.Milliseconds(),
+			EndMs:          seg.End.Milliseconds(),
+			Start:          Timestamp(seg.Start),
+			End:            Timestamp(seg.End),
+			Text:           seg.Text,
+			RawText:        seg.RawText,
+			Speaker:        seg.Speaker,
+			AvgProbability: seg.AvgProbability,
+			MinProbability: seg.MinProbability,
+			Review:         seg.Review,
+		}
+		for _, w := range seg.Words {
+			s.Words = append(s.Words, wordDocument{
+				Text:        w.Text,
+				StartMs:     w.Start.Milliseconds(),
+				EndMs:       w.End.Milliseconds(),
+				Probability: w.Probability,
+			})
+		}
+		doc.Segments[i] = s
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON reads a transcript of any version up to TranscriptVersion.
+func (t *Transcript) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var segments []SegmentResult
+		if err := json.Unmarshal(trimmed, &segments); err != nil {
+			return err
+		}
+		*t = Transcript{Segments: segments}
+		return nil
+	}
+
+	var header struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(trimmed, &header); err != nil {
+		return err
+	}
+	switch {
+	case header.Version > TranscriptVersion:
+		return fmt.Errorf("transcript version %d is newer than supported version %d", header.Version, TranscriptVersion)
+	case header.Version < 2:
+		var legacy legacyTranscript
+		if err := json.Unmarshal(trimmed, &legacy); err != nil {
+			return err
+		}
+		*t = Transcript{
+			Language:            legacy.Language,
+			LanguageProbability: legacy.LanguageProbability,
+			Translated:          legacy.Translated,
+			Segments:            legacy.Segments,
+			Version:             1,
+		}
+		return nil
+	}
+
+	var doc transcriptDocument
+	if err := json.Unmarshal(trimmed, &doc); err != nil {
+		return err
+	}
+	*t = Transcript{
+		Model:               doc.Model,
+		Options:             doc.Options,
+		Language:            doc.Language,
+		LanguageProbability: doc.LanguageProbability,
+		Translated:          doc.Translated,
+		Segments:            make([]SegmentResult, len(doc.Segments)),
+		Version:             doc.Version,
+	}
+	if doc.Source != nil {
+		t.Source = TranscriptSource{
+			Path:     doc.Source.Path,
+			SHA256:   doc.Source.SHA256,
+			Duration: time.Duration(doc.Source.DurationMs) * time.Millisecond,
+		}
+	}
+	if doc.CreatedAt != nil {
+		t.CreatedAt = *doc.CreatedAt
+	}
+	for i, s := range doc.Segments {
+		seg := SegmentResult{
+			Start:          time.Duration(s.StartMs) * time.Millisecond,
+			End:            time.Duration(s.EndMs) * time.Millisecond,
+			Text:           s.Text,
+			RawText:        s.RawText,
+			Speaker:        s.Speaker,
+			AvgProbability: s.AvgProbability,
+			MinProbability: s.MinProbability,
+			Review:         s.Review,
+		}
+		for _, w := range s.Words {
+			seg.Words = append(seg.Words, Word{
+				Text:        w.Text,
+				Start:       time.Duration(w.StartMs) * time.Millisecond,
+				End:         time.Duration(w.EndMs) * time.Millisecond,
+				Probability: w.Probability,
+			})
+		}
+		t.Segments[i] = seg
+	}
+	return nil
+}
+
+// DecodeTranscript parses a transcript file of any version, including the
+// bare segment array older runs wrote.
+func DecodeTranscript(data []byte) (*Transcript, error) {
+	var t Transcript
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to decode transcript: %v", err)
+	}
+	return &t, nil
+}
+
+// Timestamp formats d as "HH:MM:SS.mmm".
+func Timestamp(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
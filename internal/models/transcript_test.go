@@ -0,0 +1,116 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDecodeTranscriptVersions(t *testing.T) {
+	segment := SegmentResult{Start: 1500 * time.Millisecond, End: 3 * time.Second, Text: "hello"}
+	tests := []struct {
+		name    string
+		data    string
+		want    *Transcript
+		wantErr bool
+	}{
+		{
+			name: "legacy array",
+			data: `[{"start":1500000000,"end":3000000000,"text":"hello"}]`,
+			want: &Transcript{Segments: []SegmentResult{segment}},
+		},
+		{
+			name: "v1",
+			data: `{"language":"fr","language_probability":0.9,"translated":true,
+				"segments":[{"start":1500000000,"end":3000000000,"text":"hello"}]}`,
+			want: &Transcript{Language: "fr", LanguageProbability: 0.9, Translated: true,
+				Segments: []SegmentResult{segment}, Version: 1},
+		},
+		{
+			name: "v2",
+			data: `{"version":2,"source":{"path":"Video/clip.mp4","sha256":"abc","duration_ms":60000},
+				"model":"ggml-base.bin","created_at":"2026-01-02T03:04:05Z","language":"fr",
+				"segments":[{"start_ms":1500,"end_ms":3000,"start":"00:00:01.500","end":"00:00:03.000","text":"hello"}]}`,
+			want: &Transcript{
+				Source:    TranscriptSource{Path: "Video/clip.mp4", SHA256: "abc", Duration: time.Minute},
+				Model:     "ggml-base.bin",
+				CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+				Language:  "fr",
+				Segments:  []SegmentResult{segment},
+				Version:   2,
+			},
+		},
+		{
+			name:    "newer version",
+			data:    `{"version":3,"segments":[]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeTranscript([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTranscriptRoundTrip(t *testing.T) {
+	transcript := &Transcript{
+		Source:    TranscriptSource{Path: "Video/clip.mp4", SHA256: "abc", Duration: 90 * time.Second},
+		Model:     "ggml-base.bin",
+		Options:   json.RawMessage(`{"Translate":false}`),
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Language:  "en",
+		Segments: []SegmentResult{{
+			Start: 61234 * time.Millisecond,
+			End:   62500 * time.Millisecond,
+			Text:  "hello world",
+			Words: []Word{
+				{Text: "hello", Start: 61234 * time.Millisecond, End: 61800 * time.Millisecond, Probability: 0.9},
+				{Text: "world", Start: 61800 * time.Millisecond, End: 62500 * time.Millisecond, Probability: 0.8},
+			},
+			AvgProbability: 0.85,
+			MinProbability: 0.8,
+		}},
+	}
+	data, err := json.MarshalIndent(transcript, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Segments []struct {
+			StartMs int64  `json:"start_ms"`
+			Start   string `json:"start"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if s := doc.Segments[0]; s.StartMs != 61234 || s.Start != "00:01:01.234" {
+		t.Errorf("segment start written as %d / %q", s.StartMs, s.Start)
+	}
+
+	got, err := DecodeTranscript(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// MarshalIndent re-indents the options, so they compare compacted
+	var options bytes.Buffer
+	if err := json.Compact(&options, got.Options); err != nil {
+		t.Fatal(err)
+	}
+	got.Options = options.Bytes()
+	want := *transcript
+	want.Version = TranscriptVersion
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("round trip = %+v, want %+v", *got, want)
+	}
+}
@@ -1,43 +1,250 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
 	"sts/internal/config"
 	"sts/internal/models"
+	"sts/services/eval"
+	"sts/services/export"
+	"sts/services/postprocess"
+	"sts/services/search"
 	"sts/services/stt"
 	"sts/services/tts"
 	"sts/utils"
 )
 
 func main() {
+	words := flag.Bool("words", false, "add word-level timestamps to transcripts")
+	language := flag.String("language", "", `spoken language: "auto" to detect, an ISO code like "fr", or empty for the model default`)
+	translate := flag.Bool("translate", false, "also write an English translation of non-English videos (needs a multilingual model)")
+	vad := flag.Bool("vad", false, "skip silence and only transcribe detected speech")
+	speakers := flag.Int("speakers", 0, "label speakers, up to this many (0 disables diarization)")
+	formats := flag.String("formats", "", "comma separated transcript exports to write besides JSON: srt,vtt,txt,tsv,ass or all")
+	inMemory := flag.Bool("in-memory", false, "decode audio through an ffmpeg pipe instead of intermediate WAV files")
+	prompt := flag.String("prompt", "", "initial prompt to steer spelling and style (default: Video/.prompt if present)")
+	glossary := flag.String("glossary", "", "glossary file of domain terms, one per line as \"Term: variant, variant\" (default: Video/.glossary if present)")
+	glossaryReplace := flag.Bool("glossary-replace", false, "also replace the listed variants of glossary terms in transcripts")
+	review := flag.Float64("review", 0, "flag segments below this average token probability (0-1) and write a review report per video (0 disables)")
+	chunk := flag.Duration("chunk", 0, "transcribe files longer than this in overlapping chunks with resumable checkpoints, e.g. 10m (0 disables)")
+	chunkParallel := flag.Int("chunk-parallel", 1, "chunks of one file to work on at once")
+	watch := flag.Bool("watch", false, "keep running and transcribe files as they land in the video folder")
+	settle := flag.Duration("settle", stt.DefaultWatchOptions().Settle, "with -watch, how long a file must stay unchanged before it is transcribed")
+	clean := flag.Bool("clean", false, "remove filler words and tidy whitespace and casing; the raw text is kept as raw_text")
+	profanity := flag.String("profanity", "", "file of words to mask, one per line")
+	replace := flag.String("replace", "", "file of regex replacements, one \"pattern => replacement\" per line")
+	query := flag.String("search", "", "search the transcripts for a phrase, with word* for prefixes, print the hits and exit")
+	limit := flag.Int("limit", 20, "with -search, the most hits to print (0 for all)")
+	evalRefs := flag.String("eval", "", "score the transcripts against the reference transcripts (clip.txt or clip.json for clip.mp4) in this folder, print WER/CER and exit")
+	evalStrict := flag.Bool("eval-strict", false, "with -eval, count case, punctuation and filler differences as errors")
+	decode := flag.String("decode", "", "whisper decoding settings on top of STT_DECODE, e.g. \"temperature=0.2,max-len=42,split-on-word,offset=1m,duration=30s\"")
+	modelName := flag.String("model", utils.DefaultModel, "whisper model: a registry name such as small.en or large-v3-turbo-q5_0, or the path of a ggml file")
+	flag.Parse()
 
 	// Setup file system Logger
 	utils.Init()
 	lg := utils.Logger
 	lg.Println("hello sts...")
 
-	// Setup Dependencies
-	utils.SetupFFmpeg()
-	utils.SetupModel()
-	utils.SetupFFprobe(lg)
+	if *query != "" {
+		if err := searchTranscripts(stt.DefaultOptions().OutputDir, *query, *limit); err != nil {
+			log.Fatalf("Search error: %v", err)
+		}
+		return
+	}
+	if *evalRefs != "" {
+		norm := eval.DefaultNormalization()
+		if *evalStrict {
+			norm = eval.Normalization{}
+		}
+		report, err := eval.Evaluate(*evalRefs, stt.DefaultOptions().OutputDir, norm)
+		if err != nil {
+			log.Fatalf("Eval error: %v", err)
+		}
+		if err := report.Write(os.Stdout); err != nil {
+			log.Fatalf("Eval error: %v", err)
+		}
+		return
+	}
 
 	// Setup env
 	config.LoadEnv(lg)
 
+	// Setup Dependencies
+	utils.SetupFFmpeg()
+	modelFile, err := setupModel(*modelName, *language, *translate, lg)
+	if err != nil {
+		log.Fatalf("Model error: %v", err)
+	}
+	utils.SetupFFprobe(lg)
+
 	// Test
 
 	lg.Println("processing videos")
-	stt.ProcessAllVideos(lg)
+	opts := stt.DefaultOptions()
+	opts.Workers = config.STT_WORKERS
+	for _, spec := range []string{config.STT_DECODE, *decode} {
+		if opts.Decode, err = stt.ParseDecodeOptions(spec, opts.Decode); err != nil {
+			log.Fatalf("Invalid decode settings %q: %v", spec, err)
+		}
+	}
+	// Flags given on the command line win over the decode settings
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["words"] {
+		opts.Decode.WordTimestamps = *words
+	}
+	if set["language"] {
+		opts.Decode.Language = *language
+	}
+	if set["prompt"] {
+		opts.Decode.InitialPrompt = *prompt
+	}
+	opts.Translate = *translate
+	opts.VAD.Enabled = *vad
+	opts.InMemory = *inMemory
+	exports, err := export.ParseFormats(*formats)
+	if err != nil {
+		log.Fatalf("Invalid -formats: %v", err)
+	}
+	opts.Formats = exports
+	if *speakers > 0 {
+		opts.Diarizer = stt.NewClusterDiarizer(*speakers)
+	}
+	if *glossary != "" {
+		if opts.Glossary, err = stt.LoadGlossary(*glossary); err != nil {
+			log.Fatalf("Invalid -glossary: %v", err)
+		}
+	}
+	opts.GlossaryReplace = *glossaryReplace
+	opts.ReviewThreshold = float32(*review)
+	if *clean {
+		opts.Transforms = postprocess.DefaultChain()
+	}
+	if *profanity != "" {
+		words, err := postprocess.LoadWordList(*profanity)
+		if err != nil {
+			log.Fatalf("Invalid -profanity: %v", err)
+		}
+		opts.Transforms = append(opts.Transforms, postprocess.NewProfanityMask(words))
+	}
+	if *replace != "" {
+		rules, err := postprocess.LoadReplacements(*replace)
+		if err != nil {
+			log.Fatalf("Invalid -replace: %v", err)
+		}
+		opts.Transforms = append(opts.Transforms, rules...)
+	}
+	opts.Chunk.Length = *chunk
+	opts.Chunk.Parallel = *chunkParallel
+	opts.ModelPath = modelFile
+	opts.Progress = logProgress(lg)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *watch {
+		watchOpts := stt.DefaultWatchOptions()
+		watchOpts.Settle = *settle
+		if err := stt.WatchVideos(ctx, opts, watchOpts, lg); err != nil {
+			log.Fatalf("STT watch error: %v", err)
+		}
+		lg.Println("STT watch stopped")
+		return
+	}
+	result, err := stt.ProcessVideosContext(ctx, opts, lg)
+	if err != nil {
+		log.Fatalf("STT error: %v", err)
+	}
+	lg.Printf("STT finished: %d succeeded, %d failed", len(result.Succeeded), len(result.Failed))
 
 	text := "hello hi bonjour "
 	//voice := tts.Voice("en_us_001")
 	outputFile := "output.mp3"
 
-	err := tts.TTS(text, tts.Voice(models.UK_MALE_1), outputFile, false, lg)
+	err = tts.TTS(text, tts.Voice(models.UK_MALE_1), outputFile, false, lg)
 	if err != nil {
 		log.Fatalf("TTS error: %v", err)
 	}
 
 	lg.Println("TTS completed, saved to", outputFile)
 }
+
+// setupModel returns the model file to load: name itself when it is an
+// existing file, otherwise the registry model of that name, fetched if it
+// is not downloaded yet. A registry model that cannot decode language or
+// translate is refused before it is fetched.
+func setupModel(name, language string, translate bool, lg *log.Logger) (string, error) {
+	if info, err := os.Stat(name); err == nil && !info.IsDir() {
+		return name, nil
+	}
+	m, err := utils.LookupModel(name)
+	if err != nil {
+		return "", err
+	}
+	if err := m.CheckLanguage(language, translate); err != nil {
+		return "", err
+	}
+	return utils.FetchModel(m, utils.ModelSource{Mirror: config.STT_MODEL_MIRROR, Bundle: config.STT_MODEL_BUNDLE}, lg)
+}
+
+// searchTranscripts brings the index of dir up to date and prints the hits
+// of query, one per line with its file and time range.
+func searchTranscripts(dir, query string, limit int) error {
+	idx, err := search.Open(filepath.Join(dir, search.IndexFile))
+	if err != nil {
+		return err
+	}
+	if n, err := idx.Update(dir, stt.ManifestFile); err != nil {
+		return err
+	} else if n > 0 {
+		if err := idx.Save(); err != nil {
+			return err
+		}
+	}
+
+	hits := idx.Search(query, limit)
+	for _, h := range hits {
+		fmt.Printf("%s\t%s-%s\t%s\n", h.File, h.Start.Round(time.Second), h.End.Round(time.Second), h.Text)
+	}
+	if len(hits) == 0 {
+		fmt.Println("no matches")
+	}
+	return nil
+}
+
+// logProgress logs every stage change and every 10% of a file, with the
+// batch position and ETA.
+func logProgress(lg *log.Logger) stt.ProgressFunc {
+	type state struct {
+		stage  stt.Stage
+		bucket int
+	}
+	last := map[string]state{}
+	return func(e stt.ProgressEvent) {
+		now := state{e.Stage, int(e.Percent) / 10}
+		if last[e.File] == now {
+			return
+		}
+		last[e.File] = now
+
+		line := fmt.Sprintf("%s: %s %.0f%%", filepath.Base(e.File), e.Stage, e.Percent)
+		if e.RealTimeFactor > 0 {
+			line += fmt.Sprintf(" (%.2fx real time)", e.RealTimeFactor)
+		}
+		if e.ETA > 0 {
+			line += fmt.Sprintf(", %s left", e.ETA.Round(time.Second))
+		}
+		line += fmt.Sprintf(" | batch %d/%d %.0f%%", e.Batch.Finished, e.Batch.Files, e.Batch.Percent)
+		if e.Batch.ETA > 0 {
+			line += fmt.Sprintf(", ETA %s", e.Batch.ETA.Round(time.Second))
+		}
+		lg.Println(line)
+	}
+}
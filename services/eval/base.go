@@ -0,0 +1,304 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode"
+
+	"sts/internal/models"
+	"sts/services/postprocess"
+)
+
+// Normalization decides which differences between a reference and a
+// transcript are not counted as errors.
+type Normalization struct {
+	// Lowercase ignores case.
+	Lowercase bool
+
+	// Punctuation drops punctuation and symbols; apostrophes inside words
+	// are kept so "it's" stays one word.
+	Punctuation bool
+
+	// Fillers are words dropped from both sides before comparing, matched
+	// case-insensitively.
+	Fillers []string
+}
+
+// DefaultNormalization ignores case, punctuation and the default fillers,
+// which references rarely transcribe.
+func DefaultNormalization() Normalization {
+	return Normalization{Lowercase: true, Punctuation: true, Fillers: postprocess.DefaultFillers}
+}
+
+// Words normalizes text and splits it into words.
+func (n Normalization) Words(text string) []string {
+	if n.Lowercase {
+		text = strings.ToLower(text)
+	}
+	if n.Punctuation {
+		text = strings.Map(func(r rune) rune {
+			if r == '’' {
+				return '\''
+			}
+			if r != '\'' && (unicode.IsPunct(r) || unicode.IsSymbol(r)) {
+				return ' '
+			}
+			return r
+		}, text)
+	}
+
+	fillers := map[string]bool{}
+	for _, f := range n.Fillers {
+		fillers[strings.ToLower(f)] = true
+	}
+	var words []string
+	for _, w := range strings.Fields(text) {
+		if n.Punctuation {
+			if w = strings.Trim(w, "'"); w == "" {
+				continue
+			}
+		}
+		if fillers[strings.ToLower(w)] {
+			continue
+		}
+		words = append(words, w)
+	}
+	return words
+}
+
+// Counts is the outcome of aligning a hypothesis against a reference.
+type Counts struct {
+	Hits          int `json:"hits"`
+	Substitutions int `json:"substitutions"`
+	Insertions    int `json:"insertions"`
+	Deletions     int `json:"deletions"`
+}
+
+// Reference is the length of the reference: every unit is either a hit, a
+// substitution or a deletion.
+func (c Counts) Reference() int {
+	return c.Hits + c.Substitutions + c.Deletions
+}
+
+// Errors is the edit distance.
+func (c Counts) Errors() int {
+	return c.Substitutions + c.Insertions + c.Deletions
+}
+
+// Rate is the error rate, errors over reference length. It is 0 for two
+// empty texts and 1 per inserted unit against an empty reference.
+func (c Counts) Rate() float64 {
+	if c.Reference() == 0 {
+		return float64(c.Insertions)
+	}
+	return float64(c.Errors()) / float64(c.Reference())
+}
+
+// Add sums two counts, for aggregates over files.
+func (c Counts) Add(o Counts) Counts {
+	return Counts{
+		Hits:          c.Hits + o.Hits,
+		Substitutions: c.Substitutions + o.Substitutions,
+		Insertions:    c.Insertions + o.Insertions,
+		Deletions:     c.Deletions + o.Deletions,
+	}
+}
+
+// Align finds a minimum edit alignment of hyp against ref and counts its
+// operations. Only two rows of the table are kept, each cell carrying the
+// counts of its best path, so hour-long transcripts fit in memory.
+func Align[T comparable](ref, hyp []T) Counts {
+	prev := make([]Counts, len(hyp)+1)
+	cur := make([]Counts, len(hyp)+1)
+	for j := 1; j <= len(hyp); j++ {
+		prev[j] = Counts{Insertions: j}
+	}
+	for i := 1; i <= len(ref); i++ {
+		cur[0] = Counts{Deletions: i}
+		for j := 1; j <= len(hyp); j++ {
+			diag := prev[j-1]
+			if ref[i-1] == hyp[j-1] {
+				diag.Hits++
+			} else {
+				diag.Substitutions++
+			}
+			del := prev[j]
+			del.Deletions++
+			ins := cur[j-1]
+			ins.Insertions++
+
+			// On ties prefer the diagonal, then deletions, as sclite does
+			best := diag
+			if del.Errors() < best.Errors() {
+				best = del
+			}
+			if ins.Errors() < best.Errors() {
+				best = ins
+			}
+			cur[j] = best
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(hyp)]
+}
+
+// FileResult is the evaluation of one transcript.
+type FileResult struct {
+	Name  string `json:"name"`
+	Words Counts `json:"words"`
+	Chars Counts `json:"chars"`
+}
+
+// Compare scores hyp against ref, by word and by character. Characters
+// are counted over the normalized words joined by single spaces.
+func Compare(ref, hyp string, n Normalization) (words, chars Counts) {
+	refWords, hypWords := n.Words(ref), n.Words(hyp)
+	words = Align(refWords, hypWords)
+	chars = Align([]rune(strings.Join(refWords, " ")), []rune(strings.Join(hypWords, " ")))
+	return words, chars
+}
+
+// Report is the evaluation of a folder of transcripts.
+type Report struct {
+	Files []FileResult `json:"files"`
+	Words Counts       `json:"words"`
+	Chars Counts       `json:"chars"`
+
+	// Missing lists references without a transcript; they are not part
+	// of the totals.
+	Missing []string `json:"missing,omitempty"`
+}
+
+// Evaluate scores the transcripts in hypDir against the references in
+// refDir. A reference <name>.txt holds plain text and <name>.json a
+// transcript. Transcripts are named after the whole source file, so a
+// reference clip.txt is compared with clip.json or, failing that, the one
+// transcript of a source named clip, such as clip.mp4.json. A reference
+// named after the whole source, clip.mp4.txt, picks one of several.
+func Evaluate(refDir, hypDir string, n Normalization) (*Report, error) {
+	entries, err := os.ReadDir(refDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reference folder: %v", err)
+	}
+	transcripts, err := transcriptsByStem(hypDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || (ext != ".txt" && ext != ".json") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+
+		hypFile := filepath.Join(hypDir, name+".json")
+		if _, err := os.Stat(hypFile); os.IsNotExist(err) {
+			switch matches := transcripts[name]; len(matches) {
+			case 0:
+				report.Missing = append(report.Missing, name)
+				continue
+			case 1:
+				hypFile = filepath.Join(hypDir, matches[0])
+			default:
+				return nil, fmt.Errorf("reference %s matches transcripts %s; name it after the source file instead",
+					entry.Name(), strings.Join(matches, ", "))
+			}
+		}
+
+		ref, err := readText(filepath.Join(refDir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read reference %s: %v", entry.Name(), err)
+		}
+		hyp, err := readText(hypFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transcript %s: %v", filepath.Base(hypFile), err)
+		}
+
+		result := FileResult{Name: name}
+		result.Words, result.Chars = Compare(ref, hyp, n)
+		report.Files = append(report.Files, result)
+		report.Words = report.Words.Add(result.Words)
+		report.Chars = report.Chars.Add(result.Chars)
+	}
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Name < report.Files[j].Name })
+	return report, nil
+}
+
+// transcriptsByStem maps the stem of every source in dir to the names of
+// its transcripts: clip.mp4.json is listed under clip. A missing folder has
+// no transcripts.
+func transcriptsByStem(dir string) (map[string][]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transcript folder: %v", err)
+	}
+	stems := map[string][]string{}
+	for _, entry := range entries {
+		source, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok {
+			continue
+		}
+		// Translations, clip.mp4.en.json, are not in the spoken language
+		if ext := filepath.Ext(source); ext != "" && ext != ".en" {
+			stem := strings.TrimSuffix(source, ext)
+			stems[stem] = append(stems[stem], entry.Name())
+		}
+	}
+	return stems, nil
+}
+
+// readText returns the text of a plain text file, or the joined segment
+// text of a transcript.
+func readText(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Ext(path) != ".json" {
+		return string(data), nil
+	}
+	transcript, err := models.DecodeTranscript(data)
+	if err != nil {
+		return "", err
+	}
+	texts := make([]string, len(transcript.Segments))
+	for i, seg := range transcript.Segments {
+		texts[i] = seg.Text
+	}
+	return strings.Join(texts, " "), nil
+}
+
+// Write prints the report as a table, one row per file and a total row,
+// with the substitutions, deletions and insertions behind every rate.
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "file\tWER\tsub\tdel\tins\twords\tCER\tsub\tdel\tins\tchars\t")
+	row := func(name string, words, chars Counts) {
+		fmt.Fprintf(tw, "%s\t%.2f%%\t%d\t%d\t%d\t%d\t%.2f%%\t%d\t%d\t%d\t%d\t\n", name,
+			100*words.Rate(), words.Substitutions, words.Deletions, words.Insertions, words.Reference(),
+			100*chars.Rate(), chars.Substitutions, chars.Deletions, chars.Insertions, chars.Reference())
+	}
+	for _, f := range r.Files {
+		row(f.Name, f.Words, f.Chars)
+	}
+	row("total", r.Words, r.Chars)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, name := range r.Missing {
+		if _, err := fmt.Fprintf(w, "missing transcript: %s\n", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
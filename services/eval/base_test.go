@@ -0,0 +1,88 @@
+package eval
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAlign(t *testing.T) {
+	tests := []struct {
+		ref, hyp string
+		want     Counts
+	}{
+		{"", "", Counts{}},
+		{"a b c", "a b c", Counts{Hits: 3}},
+		{"a b c", "a x c", Counts{Hits: 2, Substitutions: 1}},
+		{"a b c", "a c", Counts{Hits: 2, Deletions: 1}},
+		{"a b c", "a b x c", Counts{Hits: 3, Insertions: 1}},
+		{"a b", "", Counts{Deletions: 2}},
+		{"", "a b", Counts{Insertions: 2}},
+		{"the cat sat", "cat sat down", Counts{Hits: 2, Deletions: 1, Insertions: 1}},
+	}
+	for _, tt := range tests {
+		got := Align(strings.Fields(tt.ref), strings.Fields(tt.hyp))
+		if got != tt.want {
+			t.Errorf("Align(%q, %q) = %+v, want %+v", tt.ref, tt.hyp, got, tt.want)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		ref, hyp string
+		norm     Normalization
+		wer, cer float64
+	}{
+		{"identical", "hello world", "hello world", Normalization{}, 0, 0},
+		{"normalized away", "Hello, world!", "um hello world", DefaultNormalization(), 0, 0},
+		{"strict", "Hello, world!", "hello world", Normalization{}, 1, 3.0 / 13},
+		{"one substitution", "the cat sat", "the bat sat", DefaultNormalization(), 1.0 / 3, 1.0 / 11},
+		{"empty reference", "", "extra words", DefaultNormalization(), 2, 11},
+	}
+	for _, tt := range tests {
+		words, chars := Compare(tt.ref, tt.hyp, tt.norm)
+		if words.Rate() != tt.wer || chars.Rate() != tt.cer {
+			t.Errorf("%s: WER %v CER %v, want %v and %v", tt.name, words.Rate(), chars.Rate(), tt.wer, tt.cer)
+		}
+	}
+}
+
+func TestEvaluateMatchesSourceNames(t *testing.T) {
+	refDir, hypDir := t.TempDir(), t.TempDir()
+	files := map[string]string{
+		filepath.Join(refDir, "clip.txt"):         "hello world",
+		filepath.Join(refDir, "talk.mov.txt"):     "good morning",
+		filepath.Join(refDir, "gone.txt"):         "nothing",
+		filepath.Join(hypDir, "clip.mp4.json"):    `[{"text":"hello world"}]`,
+		filepath.Join(hypDir, "clip.mp4.en.json"): `[{"text":"something else"}]`,
+		filepath.Join(hypDir, "talk.mov.json"):    `[{"text":"good morning"}]`,
+		filepath.Join(hypDir, "talk.mp4.json"):    `[{"text":"bad morning"}]`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Evaluate(refDir, hypDir, DefaultNormalization())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 2 || report.Words.Errors() != 0 {
+		t.Errorf("report = %+v, want clip and talk.mov without errors", report)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "gone" {
+		t.Errorf("missing = %v, want [gone]", report.Missing)
+	}
+
+	// talk alone could be either source
+	if err := os.WriteFile(filepath.Join(refDir, "talk.txt"), []byte("good morning"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Evaluate(refDir, hypDir, DefaultNormalization()); err == nil {
+		t.Error("ambiguous reference was scored")
+	}
+}
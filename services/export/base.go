@@ -0,0 +1,291 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"sts/internal/models"
+)
+
+// Format is a transcript file format, named after its file extension.
+type Format string
+
+const (
+	SRT Format = "srt"
+	VTT Format = "vtt"
+	TXT Format = "txt"
+	TSV Format = "tsv"
+	ASS Format = "ass"
+)
+
+// AllFormats lists every supported format.
+var AllFormats = []Format{SRT, VTT, TXT, TSV, ASS}
+
+// ParseFormats parses a comma separated list such as "srt,vtt". "all"
+// selects every format.
+func ParseFormats(list string) ([]Format, error) {
+	var formats []Format
+	seen := map[Format]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			return AllFormats, nil
+		}
+		f := Format(strings.TrimPrefix(name, "."))
+		if !f.valid() {
+			return nil, fmt.Errorf("unknown transcript format %q", name)
+		}
+		if !seen[f] {
+			seen[f] = true
+			formats = append(formats, f)
+		}
+	}
+	return formats, nil
+}
+
+func (f Format) valid() bool {
+	for _, known := range AllFormats {
+		if f == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Write renders segments to w in the given format.
+func Write(w io.Writer, format Format, segments []models.SegmentResult) error {
+	bw := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case SRT:
+		err = writeSRT(bw, segments)
+	case VTT:
+		err = writeVTT(bw, segments)
+	case TXT:
+		err = writeTXT(bw, segments)
+	case TSV:
+		err = writeTSV(bw, segments)
+	case ASS:
+		err = writeASS(bw, segments)
+	default:
+		return fmt.Errorf("unknown transcript format %q", format)
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteFiles renders segments to basePath + "." + format for every format
+// and returns the paths written.
+func WriteFiles(basePath string, formats []Format, segments []models.SegmentResult) ([]string, error) {
+	var written []string
+	for _, format := range formats {
+		path := basePath + "." + string(format)
+		if err := writeFile(path, format, segments); err != nil {
+			return written, fmt.Errorf("failed to write %s: %v", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+func writeFile(path string, format Format, segments []models.SegmentResult) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, format, segments); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// writeSRT numbers the cues it writes; segments without text would be blank
+// cues and are left out.
+func writeSRT(w io.Writer, segments []models.SegmentResult) error {
+	n := 0
+	for _, seg := range segments {
+		if strings.TrimSpace(seg.Text) == "" {
+			continue
+		}
+		n++
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n",
+			n,
+			clock(seg.Start, ","),
+			clock(seg.End, ","),
+			joinLines(withSpeaker(seg, "[%s] ")),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeVTT(w io.Writer, segments []models.SegmentResult) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		text := cueText(seg.Text)
+		if text == "" {
+			continue
+		}
+		if seg.Speaker != "" {
+			text = fmt.Sprintf("<v %s>%s", seg.Speaker, text)
+		}
+		_, err := fmt.Fprintf(w, "%s --> %s\n%s\n\n",
+			clock(seg.Start, "."),
+			clock(seg.End, "."),
+			text,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTXT(w io.Writer, segments []models.SegmentResult) error {
+	for _, seg := range segments {
+		if _, err := fmt.Fprintln(w, withSpeaker(seg, "%s: ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTSV follows whisper.cpp's layout with millisecond offsets, plus a
+// speaker column.
+func writeTSV(w io.Writer, segments []models.SegmentResult) error {
+	if _, err := io.WriteString(w, "start\tend\tspeaker\ttext\n"); err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		text := strings.NewReplacer("\t", " ", "\n", " ").Replace(strings.TrimSpace(seg.Text))
+		_, err := fmt.Fprintf(w, "%d\t%d\t%s\t%s\n", seg.Start.Round(time.Millisecond).Milliseconds(), seg.End.Round(time.Millisecond).Milliseconds(), seg.Speaker, text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// assHeader uses the style the captions burner forces on SRT files.
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 384
+PlayResY: 288
+WrapStyle: 0
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Default,TheBoldFont-Bold,15.5,&H00FFFFFF,&H000000FF,&H00000000,&H00000000,0,0,0,0,100,100,0,0,1,1.3,0,2,10,10,10,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+func writeASS(w io.Writer, segments []models.SegmentResult) error {
+	if _, err := io.WriteString(w, assHeader); err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		_, err := fmt.Fprintf(w, "Dialogue: 0,%s,%s,Default,%s,0,0,0,,%s\n",
+			assClock(seg.Start), assClock(seg.End), strings.ReplaceAll(seg.Speaker, ",", " "), assText(seg.Text))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clock formats d rounded to the millisecond as HH:MM:SS<sep>mmm.
+func clock(d time.Duration, sep string) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Round(time.Millisecond).Milliseconds()
+	h, ms := ms/3600000, ms%3600000
+	m, ms := ms/60000, ms%60000
+	s, ms := ms/1000, ms%1000
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", h, m, s, sep, ms)
+}
+
+// assClock formats d rounded to the centisecond as H:MM:SS.cc, ASS only has
+// centiseconds.
+func assClock(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	cs := int64(d.Round(10*time.Millisecond) / (10 * time.Millisecond))
+	h, cs := cs/360000, cs%360000
+	m, cs := cs/6000, cs%6000
+	s, cs := cs/100, cs%100
+	return fmt.Sprintf("%d:%02d:%02d.%02d", h, m, s, cs)
+}
+
+func withSpeaker(seg models.SegmentResult, format string) string {
+	text := strings.TrimSpace(seg.Text)
+	if seg.Speaker == "" {
+		return text
+	}
+	return fmt.Sprintf(format, seg.Speaker) + text
+}
+
+// assText keeps the text of a Dialogue line from being read as override
+// tags or escapes, and turns line breaks into ASS hard breaks. ASS cannot
+// escape a backslash, so like ffmpeg a word joiner is put after one that
+// would start an escape.
+func assText(text string) string {
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\r\n", "\n")
+	var b strings.Builder
+	for i, r := range text {
+		switch r {
+		case '{', '}':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\N`)
+		case '\\':
+			b.WriteRune(r)
+			if i+1 < len(text) && strings.IndexByte("nNh{}", text[i+1]) >= 0 {
+				b.WriteString("\u2060")
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// joinLines drops the blank lines that would end an SRT cue early.
+func joinLines(text string) string {
+	for strings.Contains(text, "\n\n") {
+		text = strings.ReplaceAll(text, "\n\n", "\n")
+	}
+	return text
+}
+
+// cueText escapes markup and keeps a WebVTT cue from ending early on a blank
+// line or "-->".
+func cueText(text string) string {
+	text = strings.TrimSpace(text)
+	text = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+	return joinLines(text)
+}
@@ -0,0 +1,83 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sts/internal/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenSegments covers speakers, an empty segment, markup, blank lines and
+// times that round up to the next second, hour and centisecond.
+var goldenSegments = []models.SegmentResult{
+	{Start: -5 * time.Millisecond, End: 1500 * time.Millisecond, Text: " Hello there. ", Speaker: "SPEAKER_1"},
+	{Start: 1500 * time.Millisecond, End: 2 * time.Second, Text: "  "},
+	{Start: 61234500 * time.Microsecond, End: 3661999600 * time.Microsecond, Text: "a < b & c\n\nd --> e", Speaker: "SPEAKER_2"},
+	{Start: 3662004999 * time.Microsecond, End: 3662005 * time.Millisecond, Text: "{\\b1}bold{\\b0} \\N not\tbroken, ok"},
+}
+
+func TestWriteGolden(t *testing.T) {
+	for _, format := range AllFormats {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, format, goldenSegments); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", "golden."+string(format))
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s output differs from %s:\n%s", format, golden, buf.Bytes())
+			}
+		})
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	if err := Write(&bytes.Buffer{}, Format("doc"), goldenSegments); err == nil {
+		t.Error("unknown format written")
+	}
+}
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []Format
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"srt, .VTT,srt", []Format{SRT, VTT}, false},
+		{"txt,all", AllFormats, false},
+		{"srt,doc", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseFormats(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseFormats(%q) error = %v, want error %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseFormats(%q) = %v, want %v", tt.list, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseFormats(%q) = %v, want %v", tt.list, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package postprocess
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"sts/internal/models"
+)
+
+// Transform rewrites the text of transcript segments. It sees the whole
+// transcript so it can look at neighbouring segments, as casing does.
+type Transform interface {
+	// Apply rewrites Text of the segments in place.
+	Apply(segments []models.SegmentResult)
+
+	// String describes the transform and its settings. It is part of the
+	// options fingerprint, so it must not change between runs.
+	String() string
+}
+
+// Chain applies its transforms in order.
+type Chain []Transform
+
+// Apply runs every transform over segments.
+func (c Chain) Apply(segments []models.SegmentResult) {
+	for _, t := range c {
+		t.Apply(segments)
+	}
+}
+
+func (c Chain) String() string {
+	names := make([]string, len(c))
+	for i, t := range c {
+		names[i] = t.String()
+	}
+	return strings.Join(names, " | ")
+}
+
+// KeepRaw copies Text to RawText on every segment that has no RawText yet,
+// so the text whisper produced survives the transforms.
+func KeepRaw(segments []models.SegmentResult) {
+	for i := range segments {
+		if segments[i].RawText == "" {
+			segments[i].RawText = segments[i].Text
+		}
+	}
+}
+
+// DefaultChain removes fillers and then tidies whitespace and casing.
+func DefaultChain() Chain {
+	return Chain{NewFillerRemover(DefaultFillers), Whitespace{}, Casing{}}
+}
+
+// eachText replaces the text of every segment with fn of it.
+func eachText(segments []models.SegmentResult, fn func(string) string) {
+	for i := range segments {
+		segments[i].Text = fn(segments[i].Text)
+	}
+}
+
+// DefaultFillers are the hesitation sounds whisper tends to write out.
+var DefaultFillers = []string{"um", "umm", "uh", "uhh", "uhm", "erm", "hmm", "mhm"}
+
+// FillerRemover drops filler words, keeping sentence punctuation that was
+// attached to them: "so, um." becomes "so.".
+type FillerRemover struct {
+	fillers map[string]bool
+}
+
+// NewFillerRemover removes the given words, matched case-insensitively.
+func NewFillerRemover(words []string) *FillerRemover {
+	f := &FillerRemover{fillers: map[string]bool{}}
+	for _, w := range words {
+		f.fillers[strings.ToLower(w)] = true
+	}
+	return f
+}
+
+func (f *FillerRemover) Apply(segments []models.SegmentResult) {
+	eachText(segments, f.remove)
+}
+
+func (f *FillerRemover) remove(text string) string {
+	var kept []string
+	for _, field := range strings.Fields(text) {
+		word := strings.TrimRight(field, ",.!?;:…")
+		if !f.fillers[strings.ToLower(word)] {
+			kept = append(kept, field)
+			continue
+		}
+		// Carry a sentence end over to the word before the filler
+		end := strings.TrimLeft(field[len(word):], ",")
+		if n := len(kept); n > 0 && end != "" && !endsSentence(kept[n-1]) {
+			kept[n-1] = strings.TrimRight(kept[n-1], ",;:") + end
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func (f *FillerRemover) String() string {
+	return "fillers(" + strings.Join(sortedKeys(f.fillers), ",") + ")"
+}
+
+// Whitespace collapses runs of whitespace, trims the ends and removes
+// spaces before punctuation.
+type Whitespace struct{}
+
+var spaceBeforePunct = regexp.MustCompile(`\s+([,.!?;:])`)
+
+func (Whitespace) Apply(segments []models.SegmentResult) {
+	eachText(segments, func(text string) string {
+		text = strings.Join(strings.Fields(text), " ")
+		return spaceBeforePunct.ReplaceAllString(text, "$1")
+	})
+}
+
+func (Whitespace) String() string { return "whitespace" }
+
+// Casing capitalizes the start of every sentence, including a segment that
+// follows one ending a sentence, and the pronoun "I".
+type Casing struct{}
+
+var (
+	sentenceStart = regexp.MustCompile(`([.!?]\s+)(\p{Ll})`)
+	pronounI      = regexp.MustCompile(`(^|\s)i('|\s|$|[,!?;:])`)
+)
+
+func (Casing) Apply(segments []models.SegmentResult) {
+	newSentence := true
+	for i := range segments {
+		text := segments[i].Text
+		if text == "" {
+			continue
+		}
+		if newSentence {
+			text = upperFirst(text)
+		}
+		text = sentenceStart.ReplaceAllStringFunc(text, func(m string) string {
+			r, size := utf8.DecodeLastRuneInString(m)
+			return m[:len(m)-size] + string(unicode.ToUpper(r))
+		})
+		text = pronounI.ReplaceAllString(text, "${1}I${2}")
+		segments[i].Text = text
+		newSentence = endsSentence(text)
+	}
+}
+
+func (Casing) String() string { return "casing" }
+
+// ProfanityMask replaces every letter but the first of listed words with
+// asterisks.
+type ProfanityMask struct {
+	words   []string
+	pattern *regexp.Regexp
+}
+
+// NewProfanityMask masks the given words, matched case-insensitively as
+// whole words in any script.
+func NewProfanityMask(words []string) *ProfanityMask {
+	m := &ProfanityMask{}
+	set := map[string]bool{}
+	for _, w := range words {
+		if w = strings.ToLower(strings.TrimSpace(w)); w != "" {
+			set[w] = true
+		}
+	}
+	m.words = sortedKeys(set)
+	if len(m.words) == 0 {
+		return m
+	}
+
+	// Longer words first, so "ass" does not stop "asshole" from matching.
+	// \b only knows ASCII letters, so the word boundary before a match is
+	// spelled out here and the one after it is checked in mask.
+	alternatives := make([]string, len(m.words))
+	for i, w := range m.words {
+		alternatives[i] = regexp.QuoteMeta(w)
+	}
+	sort.SliceStable(alternatives, func(i, j int) bool { return len(alternatives[i]) > len(alternatives[j]) })
+	m.pattern = regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}])(` + strings.Join(alternatives, "|") + `)`)
+	return m
+}
+
+func (m *ProfanityMask) Apply(segments []models.SegmentResult) {
+	if m.pattern == nil {
+		return
+	}
+	eachText(segments, m.mask)
+}
+
+func (m *ProfanityMask) mask(text string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range m.pattern.FindAllStringSubmatchIndex(text, -1) {
+		start, end := loc[2], loc[3]
+		if next, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(next) {
+			continue
+		}
+		word := text[start:end]
+		_, size := utf8.DecodeRuneInString(word)
+		b.WriteString(text[last:start])
+		b.WriteString(word[:size] + strings.Repeat("*", utf8.RuneCountInString(word[size:])))
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// String identifies the list by a hash of its sorted words, so changing a
+// single word changes the fingerprint without writing the words into every
+// transcript.
+func (m *ProfanityMask) String() string {
+	sum := sha256.Sum256([]byte(strings.Join(m.words, "\n")))
+	return fmt.Sprintf("profanity(%d words, %x)", len(m.words), sum[:8])
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// RegexReplace replaces every match of a pattern, with $1 style references
+// to its groups.
+type RegexReplace struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// NewRegexReplace compiles pattern.
+func NewRegexReplace(pattern, replacement string) (*RegexReplace, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+	}
+	return &RegexReplace{pattern: re, replacement: replacement}, nil
+}
+
+func (r *RegexReplace) Apply(segments []models.SegmentResult) {
+	eachText(segments, func(text string) string {
+		return r.pattern.ReplaceAllString(text, r.replacement)
+	})
+}
+
+func (r *RegexReplace) String() string {
+	return fmt.Sprintf("regex(%s => %s)", r.pattern, r.replacement)
+}
+
+// LoadWordList reads one word or phrase per line, skipping blank lines and
+// # comments.
+func LoadWordList(path string) ([]string, error) {
+	var words []string
+	err := readLines(path, func(n int, line string) error {
+		words = append(words, line)
+		return nil
+	})
+	return words, err
+}
+
+// LoadReplacements reads one "pattern => replacement" rule per line,
+// skipping blank lines and # comments, and returns them in order.
+func LoadReplacements(path string) (Chain, error) {
+	var chain Chain
+	err := readLines(path, func(n int, line string) error {
+		pattern, replacement, ok := strings.Cut(line, "=>")
+		if !ok {
+			return fmt.Errorf("line %d: expected \"pattern => replacement\"", n)
+		}
+		r, err := NewRegexReplace(strings.TrimSpace(pattern), strings.TrimSpace(replacement))
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n, err)
+		}
+		chain = append(chain, r)
+		return nil
+	})
+	return chain, err
+}
+
+func readLines(path string, fn func(n int, line string) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := fn(n, line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func endsSentence(text string) bool {
+	text = strings.TrimRight(text, `"')]`)
+	return strings.HasSuffix(text, ".") || strings.HasSuffix(text, "!") ||
+		strings.HasSuffix(text, "?") || strings.HasSuffix(text, "…")
+}
+
+func upperFirst(text string) string {
+	for i, r := range text {
+		if unicode.IsLetter(r) {
+			return text[:i] + string(unicode.ToUpper(r)) + text[i+utf8.RuneLen(r):]
+		}
+		if !unicode.IsSpace(r) && !unicode.IsPunct(r) {
+			return text
+		}
+	}
+	return text
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
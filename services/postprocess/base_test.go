@@ -0,0 +1,136 @@
+package postprocess
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sts/internal/models"
+)
+
+// apply runs t over segments with the given texts and returns the results.
+func apply(t Transform, texts ...string) []string {
+	segments := make([]models.SegmentResult, len(texts))
+	for i, text := range texts {
+		segments[i].Text = text
+	}
+	t.Apply(segments)
+	out := make([]string, len(segments))
+	for i, seg := range segments {
+		out[i] = seg.Text
+	}
+	return out
+}
+
+func TestTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform Transform
+		in, want  []string
+	}{
+		{"filler", NewFillerRemover(DefaultFillers), []string{"so um I think"}, []string{"so I think"}},
+		{"filler case", NewFillerRemover(DefaultFillers), []string{"Uh, right"}, []string{"right"}},
+		{"filler keeps sentence end", NewFillerRemover(DefaultFillers), []string{"so, um. Next"}, []string{"so. Next"}},
+		{"filler after sentence end", NewFillerRemover(DefaultFillers), []string{"done. uh."}, []string{"done."}},
+		{"filler only", NewFillerRemover(DefaultFillers), []string{"hmm"}, []string{""}},
+		{"filler inside word", NewFillerRemover(DefaultFillers), []string{"umbrella"}, []string{"umbrella"}},
+		{"whitespace", Whitespace{}, []string{"  hello   world ,  ok  . "}, []string{"hello world, ok."}},
+		{"casing sentences", Casing{}, []string{"hello. how are you? fine"}, []string{"Hello. How are you? Fine"}},
+		{"casing across segments", Casing{}, []string{"it ends here.", "new one", "and goes on"}, []string{"It ends here.", "New one", "and goes on"}},
+		{"casing pronoun", Casing{}, []string{"so i think i'm right, i"}, []string{"So I think I'm right, I"}},
+		{"casing non-latin", Casing{}, []string{"ça va. éric est là"}, []string{"Ça va. Éric est là"}},
+		{"default chain", DefaultChain(), []string{"um  so uh i think ,", "yes. ok"}, []string{"So I think,", "yes. Ok"}},
+	}
+	for _, tt := range tests {
+		got := apply(tt.transform, tt.in...)
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: %q became %q, want %q", tt.name, tt.in, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestProfanityMask(t *testing.T) {
+	mask := NewProfanityMask([]string{"darn", "Heck", "merde", "блин", "ass", "asshole", " "})
+	tests := []struct{ in, want string }{
+		{"darn it", "d*** it"},
+		{"DARN, Heck!", "D***, H***!"},
+		{"darn darn", "d*** d***"},
+		{"darned hecking", "darned hecking"},
+		{"oh merde.", "oh m****."},
+		{"ну блин", "ну б***"},
+		{"emerdé", "emerdé"},
+		{"asshole and assessment", "a****** and assessment"},
+		{"ass2", "ass2"},
+	}
+	for _, tt := range tests {
+		if got := apply(mask, tt.in)[0]; got != tt.want {
+			t.Errorf("%q masked to %q, want %q", tt.in, got, tt.want)
+		}
+	}
+	if got := apply(NewProfanityMask(nil), "darn")[0]; got != "darn" {
+		t.Errorf("empty mask changed text to %q", got)
+	}
+}
+
+func TestProfanityMaskString(t *testing.T) {
+	a := NewProfanityMask([]string{"darn", "heck"})
+	if b := NewProfanityMask([]string{"Heck", "darn", "darn"}); a.String() != b.String() {
+		t.Errorf("same words in another order: %s and %s", a, b)
+	}
+	if c := NewProfanityMask([]string{"darn", "drat"}); a.String() == c.String() {
+		t.Errorf("different words give the same description %s", a)
+	}
+}
+
+func TestLoadReplacements(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"rules in order", "# house style\n\ncolour => color\n(\\d+) percent => $1%\n", "colour 5 percent", "color 5%", false},
+		{"arrow in replacement", "a => b => c\n", "a", "b => c", false},
+		{"empty replacement", "um+ =>\n", "ummm ok", " ok", false},
+		{"missing arrow", "colour color\n", "", "", true},
+		{"invalid pattern", "( => x\n", "", "", true},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "rules.txt")
+		if err := os.WriteFile(path, []byte(tt.file), 0644); err != nil {
+			t.Fatal(err)
+		}
+		chain, err := LoadReplacements(path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if got := apply(chain, tt.in)[0]; got != tt.want {
+			t.Errorf("%s: %q became %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+	if _, err := LoadReplacements(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file loaded")
+	}
+}
+
+func TestLoadWordList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# words\ndarn\n\n  heck  \nbad word\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	words, err := LoadWordList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(words) != 3 || words[0] != "darn" || words[1] != "heck" || words[2] != "bad word" {
+		t.Errorf("words = %q", words)
+	}
+}
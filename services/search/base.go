@@ -0,0 +1,364 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"sts/internal/models"
+)
+
+// IndexFile is the name of the index inside the transcript folder.
+const IndexFile = "search-index.json"
+
+// Index is an inverted index over the segment text of transcript files.
+// Every transcript is one token stream, so phrases are found across the
+// segment boundaries whisper puts in the middle of sentences.
+type Index struct {
+	path   string
+	mu     sync.RWMutex
+	saveMu sync.Mutex // serializes writers of the temporary file
+
+	docs     map[string]*document
+	postings map[string][]posting // term -> every occurrence
+	terms    []string             // sorted vocabulary, for prefix queries; nil when stale
+}
+
+// document is one indexed transcript. Only documents are saved; postings
+// are rebuilt on load.
+type document struct {
+	ModTime  time.Time        `json:"mod_time"`
+	Size     int64            `json:"size"`
+	Segments []indexedSegment `json:"segments"`
+	Tokens   []string         `json:"tokens"`
+	TokenSeg []int            `json:"token_segments"` // segment of every token
+}
+
+type indexedSegment struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	Text  string        `json:"text"`
+}
+
+type posting struct {
+	doc string
+	pos int
+}
+
+// Hit is a match of a query in one transcript.
+type Hit struct {
+	File  string
+	Start time.Duration
+	End   time.Duration
+
+	// Text of the segments the match spans
+	Text string
+}
+
+// Open loads the index saved at path. A missing file yields an empty index
+// that is created on the first Save.
+func Open(path string) (*Index, error) {
+	idx := &Index{path: path, docs: map[string]*document{}, postings: map[string][]posting{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search index: %v", err)
+	}
+	if err := json.Unmarshal(data, &idx.docs); err != nil {
+		return nil, fmt.Errorf("failed to parse search index %s: %v", path, err)
+	}
+	for file, doc := range idx.docs {
+		idx.addPostings(file, doc)
+	}
+	return idx, nil
+}
+
+// Save writes the index back to the path it was opened from.
+func (idx *Index) Save() error {
+	idx.saveMu.Lock()
+	defer idx.saveMu.Unlock()
+	idx.mu.RLock()
+	data, err := json.Marshal(idx.docs)
+	idx.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal search index: %v", err)
+	}
+	tmp := idx.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to write search index: %v", err)
+	}
+	return os.Rename(tmp, idx.path)
+}
+
+// Add indexes transcript under file, replacing what was indexed for it.
+func (idx *Index) Add(file string, transcript *models.Transcript) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	doc := newDocument(transcript)
+	doc.ModTime, doc.Size = info.ModTime(), info.Size()
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	file = filepath.Clean(file)
+	idx.removeLocked(file)
+	idx.docs[file] = doc
+	idx.addPostings(file, doc)
+	return nil
+}
+
+// Remove drops file from the index.
+func (idx *Index) Remove(file string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.removeLocked(filepath.Clean(file))
+}
+
+// Update brings the index in line with the transcripts in dir: new and
+// changed files are indexed, deleted ones dropped. It returns the number of
+// files indexed.
+func (idx *Index) Update(dir string, skip ...string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read transcript folder: %v", err)
+	}
+	skipped := map[string]bool{IndexFile: true}
+	for _, name := range skip {
+		skipped[name] = true
+	}
+
+	present := map[string]bool{}
+	indexed := 0
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") || skipped[name] || strings.HasPrefix(name, ".") {
+			continue
+		}
+		file := filepath.Join(dir, name)
+		present[file] = true
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		idx.mu.RLock()
+		doc, ok := idx.docs[file]
+		idx.mu.RUnlock()
+		if ok && doc.ModTime.Equal(info.ModTime()) && doc.Size == info.Size() {
+			continue
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return indexed, err
+		}
+		transcript, err := models.DecodeTranscript(data)
+		if err != nil {
+			continue // not a transcript
+		}
+		if err := idx.Add(file, transcript); err != nil {
+			return indexed, err
+		}
+		indexed++
+	}
+
+	idx.mu.Lock()
+	for file := range idx.docs {
+		if filepath.Dir(file) == filepath.Clean(dir) && !present[file] {
+			idx.removeLocked(file)
+		}
+	}
+	idx.mu.Unlock()
+	return indexed, nil
+}
+
+// Search finds query in every transcript. Query words match whole tokens,
+// case-insensitively, as a phrase in that order; a word ending in * matches
+// every token it prefixes. Hits are ordered by file and time, at most limit
+// of them when limit is positive.
+func (idx *Index) Search(query string, limit int) []Hit {
+	terms := parseQuery(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var hits []Hit
+	for _, p := range idx.anchors(terms[0]) {
+		doc := idx.docs[p.doc]
+		if !doc.matchesAt(p.pos, terms) {
+			continue
+		}
+		first, last := doc.TokenSeg[p.pos], doc.TokenSeg[p.pos+len(terms)-1]
+		texts := make([]string, 0, last-first+1)
+		for s := first; s <= last; s++ {
+			texts = append(texts, strings.TrimSpace(doc.Segments[s].Text))
+		}
+		hits = append(hits, Hit{
+			File:  p.doc,
+			Start: doc.Segments[first].Start,
+			End:   doc.Segments[last].End,
+			Text:  strings.Join(texts, " "),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].File != hits[j].File {
+			return hits[i].File < hits[j].File
+		}
+		return hits[i].Start < hits[j].Start
+	})
+	hits = dedupe(hits)
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+type queryTerm struct {
+	text   string
+	prefix bool
+}
+
+// parseQuery tokenizes query like the transcripts. A trailing * makes the
+// last token of its word a prefix.
+func parseQuery(query string) []queryTerm {
+	var terms []queryTerm
+	for _, word := range strings.Fields(query) {
+		prefix := strings.HasSuffix(word, "*")
+		tokens := Tokenize(strings.TrimRight(word, "*"))
+		for i, token := range tokens {
+			terms = append(terms, queryTerm{text: token, prefix: prefix && i == len(tokens)-1})
+		}
+	}
+	return terms
+}
+
+func (q queryTerm) matches(token string) bool {
+	if q.prefix {
+		return strings.HasPrefix(token, q.text)
+	}
+	return token == q.text
+}
+
+// anchors returns every occurrence of the first query term; idx.mu must be
+// held for writing since the vocabulary may be rebuilt.
+func (idx *Index) anchors(q queryTerm) []posting {
+	if !q.prefix {
+		return idx.postings[q.text]
+	}
+	if idx.terms == nil {
+		idx.terms = make([]string, 0, len(idx.postings))
+		for term := range idx.postings {
+			idx.terms = append(idx.terms, term)
+		}
+		sort.Strings(idx.terms)
+	}
+	var found []posting
+	for i := sort.SearchStrings(idx.terms, q.text); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], q.text); i++ {
+		found = append(found, idx.postings[idx.terms[i]]...)
+	}
+	return found
+}
+
+func (doc *document) matchesAt(pos int, terms []queryTerm) bool {
+	if pos+len(terms) > len(doc.Tokens) {
+		return false
+	}
+	for i, q := range terms {
+		if !q.matches(doc.Tokens[pos+i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupe merges hits of the same file and time range, which several matches
+// inside one segment produce.
+func dedupe(hits []Hit) []Hit {
+	kept := hits[:0]
+	for _, h := range hits {
+		if n := len(kept); n > 0 && kept[n-1].File == h.File && kept[n-1].Start == h.Start && kept[n-1].End == h.End {
+			continue
+		}
+		kept = append(kept, h)
+	}
+	return kept
+}
+
+func newDocument(transcript *models.Transcript) *document {
+	doc := &document{}
+	for i, seg := range transcript.Segments {
+		doc.Segments = append(doc.Segments, indexedSegment{Start: seg.Start, End: seg.End, Text: seg.Text})
+		for _, token := range Tokenize(seg.Text) {
+			doc.Tokens = append(doc.Tokens, token)
+			doc.TokenSeg = append(doc.TokenSeg, i)
+		}
+	}
+	return doc
+}
+
+func (idx *Index) addPostings(file string, doc *document) {
+	for pos, token := range doc.Tokens {
+		if _, ok := idx.postings[token]; !ok {
+			idx.terms = nil
+		}
+		idx.postings[token] = append(idx.postings[token], posting{doc: file, pos: pos})
+	}
+}
+
+func (idx *Index) removeLocked(file string) {
+	doc, ok := idx.docs[file]
+	if !ok {
+		return
+	}
+	delete(idx.docs, file)
+	seen := map[string]bool{}
+	for _, token := range doc.Tokens {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		list := idx.postings[token]
+		kept := list[:0]
+		for _, p := range list {
+			if p.doc != file {
+				kept = append(kept, p)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.postings, token)
+			idx.terms = nil
+		} else {
+			idx.postings[token] = kept
+		}
+	}
+}
+
+// Tokenize splits text into lower-case words of letters and digits, keeping
+// apostrophes inside words such as "it's".
+func Tokenize(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\'' && r != '’'
+	})
+	tokens := fields[:0]
+	for _, f := range fields {
+		f = strings.Trim(strings.ReplaceAll(f, "’", "'"), "'")
+		if f != "" {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
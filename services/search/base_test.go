@@ -0,0 +1,111 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"sts/internal/models"
+)
+
+// testIndex indexes two transcripts written to a temporary folder.
+func testIndex(t *testing.T) (*Index, string) {
+	t.Helper()
+	dir := t.TempDir()
+	transcripts := map[string][]models.SegmentResult{
+		"a.mp4.json": {
+			{Start: 0, End: 2 * time.Second, Text: "Welcome to the quarterly"},
+			{Start: 2 * time.Second, End: 4 * time.Second, Text: "review meeting."},
+			{Start: 4 * time.Second, End: 6 * time.Second, Text: "It's about reviews, and the review process."},
+		},
+		"b.mp4.json": {
+			{Start: 0, End: 3 * time.Second, Text: "The quarterly numbers are in."},
+		},
+	}
+	idx, err := Open(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, segments := range transcripts {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.Add(path, &models.Transcript{Segments: segments}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return idx, dir
+}
+
+type hitSpan struct {
+	File       string
+	Start, End time.Duration
+}
+
+func spans(hits []Hit) []hitSpan {
+	var out []hitSpan
+	for _, h := range hits {
+		out = append(out, hitSpan{filepath.Base(h.File), h.Start, h.End})
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	idx, _ := testIndex(t)
+	s := time.Second
+	tests := []struct {
+		query string
+		want  []hitSpan
+	}{
+		{"quarterly", []hitSpan{{"a.mp4.json", 0, 2 * s}, {"b.mp4.json", 0, 3 * s}}},
+		{"QUARTERLY Review", []hitSpan{{"a.mp4.json", 0, 4 * s}}},
+		{"review process", []hitSpan{{"a.mp4.json", 4 * s, 6 * s}}},
+		{"process review", nil},
+		{"it's", []hitSpan{{"a.mp4.json", 4 * s, 6 * s}}},
+		{"review*", []hitSpan{{"a.mp4.json", 2 * s, 4 * s}, {"a.mp4.json", 4 * s, 6 * s}}},
+		{"the review*", []hitSpan{{"a.mp4.json", 4 * s, 6 * s}}},
+		{"quart* numbers", []hitSpan{{"b.mp4.json", 0, 3 * s}}},
+		{"rev", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := spans(idx.Search(tt.query, 0)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if got := idx.Search("quarterly", 1); len(got) != 1 {
+		t.Errorf("limit 1 returned %d hits", len(got))
+	}
+	if got := idx.Search("quarterly review", 0); len(got) != 1 || got[0].Text != "Welcome to the quarterly review meeting." {
+		t.Errorf("phrase across segments = %+v", got)
+	}
+}
+
+func TestSaveAndUpdate(t *testing.T) {
+	idx, dir := testIndex(t)
+	if err := idx.Save(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := Open(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(spans(reopened.Search("review*", 0)), spans(idx.Search("review*", 0))) {
+		t.Error("reopened index finds different hits")
+	}
+
+	// A deleted transcript is dropped from the index
+	if err := os.Remove(filepath.Join(dir, "b.mp4.json")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Update(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := spans(reopened.Search("quarterly", 0)); len(got) != 1 || got[0].File != "a.mp4.json" {
+		t.Errorf("after removal = %v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package stt
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// decodePCM runs ffmpeg with raw 32-bit float output on stdout and collects
+// the 16 kHz mono samples without any intermediate file. Decoding progress
+// is read from stderr and passed to report, which may be nil.
+func decodePCM(ctx context.Context, path string, info *MediaInfo, report func(float64)) ([]float32, error) {
+	var duration time.Duration
+	if info != nil {
+		duration = info.Duration
+	}
+	return runPCMDecode(ctx, []string{"-i", path}, duration, report)
+}
+
+// decodePCMRange is decodePCM for length of audio from start on. ffmpeg
+// seeks in the input, so only that range is ever decoded.
+func decodePCMRange(ctx context.Context, path string, start, length time.Duration, report func(float64)) ([]float32, error) {
+	input := []string{
+		"-ss", strconv.FormatFloat(start.Seconds(), 'f', 3, 64),
+		"-t", strconv.FormatFloat(length.Seconds(), 'f', 3, 64),
+		"-i", path,
+	}
+	return runPCMDecode(ctx, input, length, report)
+}
+
+// runPCMDecode runs ffmpeg on the input options and reads the samples it
+// writes; duration is the expected length for progress reports.
+func runPCMDecode(ctx context.Context, input []string, duration time.Duration, report func(float64)) ([]float32, error) {
+	args := []string{"-nostdin", "-v", "error", "-nostats", "-progress", "pipe:2"}
+	args = append(args, input...)
+	args = append(args, "-vn", "-ac", "1", "-ar", "16000", "-f", "f32le", "pipe:1")
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	progress, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start ffmpeg: %v", err)
+	}
+
+	var stderr bytes.Buffer
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		ffmpegProgress(progress, duration, report, &stderr)
+	}()
+
+	// Size the buffer from the expected duration to avoid regrowing it
+	samples, readErr := readFloat32LE(stdout, durationToSamples(duration)+SampleRate)
+	if readErr != nil {
+		// ffmpeg would block on a full pipe nobody drains anymore
+		_ = cmd.Process.Kill()
+	}
+	<-progressDone
+
+	if err := cmd.Wait(); err != nil {
+		return nil, fmt.Errorf("ffmpeg decode failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read decoded audio: %v", readErr)
+	}
+	return samples, nil
+}
+
+// readFloat32LE reads little-endian float32 samples until EOF. A trailing
+// partial sample is dropped.
+func readFloat32LE(r io.Reader, capacity int) ([]float32, error) {
+	samples := make([]float32, 0, capacity)
+	br := bufio.NewReaderSize(r, 64*1024)
+	buf := make([]byte, 64*1024)
+	var carry int
+	for {
+		n, err := br.Read(buf[carry:])
+		n += carry
+		whole := n - n%4
+		for i := 0; i < whole; i += 4 {
+			samples = append(samples, math.Float32frombits(binary.LittleEndian.Uint32(buf[i:])))
+		}
+		carry = copy(buf, buf[whole:n])
+		if errors.Is(err, io.EOF) {
+			return samples, nil
+		}
+		if err != nil {
+			return samples, err
+		}
+	}
+}
+
+// ffmpegProgress reads the key=value stream of ffmpeg's -progress option
+// until EOF and reports the fraction of total decoded so far. Lines that are
+// not progress keys, such as error messages sharing the pipe, go to rest.
+func ffmpegProgress(r io.Reader, total time.Duration, report func(float64), rest io.Writer) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || !progressKeys[key] && !strings.HasPrefix(key, "stream_") {
+			fmt.Fprintln(rest, line)
+			continue
+		}
+		// out_time_ms is in microseconds as well, despite its name
+		if (key == "out_time_us" || key == "out_time_ms") && total > 0 && report != nil {
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil {
+				report(float64(time.Duration(us)*time.Microsecond) / float64(total))
+			}
+		}
+	}
+	// Keep draining so ffmpeg never blocks on a full pipe
+	_, _ = io.Copy(io.Discard, r)
+}
+
+var progressKeys = map[string]bool{
+	"frame": true, "fps": true, "bitrate": true, "total_size": true,
+	"out_time_us": true, "out_time_ms": true, "out_time": true,
+	"dup_frames": true, "drop_frames": true, "speed": true, "progress": true,
+}
@@ -1,29 +1,95 @@
 package stt
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-
-	"github.com/ggerganov/whisper.cpp/bindings/go/pkg/whisper"
-	"github.com/go-audio/wav"
+	"sync/atomic"
+	"time"
 
 	"sts/internal/models"
+	"sts/services/export"
+	"sts/services/postprocess"
 )
 
-// ProcessAllVideos scans the Video folder and processes each video file
+// ProcessAllVideos scans the Video folder and processes each file with audio
 func ProcessAllVideos(logger *log.Logger) error {
-	videoDir := "Video"
-	audioDir := "audio"
-	ttsDir := "stt"
-	modelPath := "models/ggml-base.en.bin"
+	result, err := ProcessVideos(DefaultOptions(), logger)
+	if err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+// ProcessVideos transcribes every file in opts.VideoDir that ffprobe finds an
+// audio stream in, with a bounded pool of workers sharing one model.
+// Per-file failures are collected in the result; the error is only set when
+// the batch could not start at all.
+func ProcessVideos(opts Options, logger *log.Logger) (*BatchResult, error) {
+	return ProcessVideosContext(context.Background(), opts, logger)
+}
+
+// ProcessVideosContext is ProcessVideos with cancellation. Cancelling ctx kills
+// running ffmpeg processes, aborts whisper at its next encoder window and
+// records every unfinished file as failed with the context error.
+func ProcessVideosContext(ctx context.Context, opts Options, logger *log.Logger) (*BatchResult, error) {
+	if err := ensureFolders(opts, logger); err != nil {
+		return nil, err
+	}
+
+	// Read video files
+	files, err := os.ReadDir(opts.VideoDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read video folder: %v", err)
+	}
+
+	// Keep whatever ffprobe finds an audio stream in, whatever the extension
+	var jobs []mediaJob
+	durations := map[string]time.Duration{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(opts.VideoDir, file.Name())
+		info, err := ProbeMedia(ctx, path)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			logger.Printf("Ignoring %s (not a media file: %v)", file.Name(), err)
+			continue
+		}
+		if !info.HasAudio {
+			logger.Printf("Ignoring %s (no audio stream)", file.Name())
+			continue
+		}
+		jobs = append(jobs, mediaJob{path: path, info: info})
+		durations[path] = info.Duration
+	}
+
+	if len(jobs) == 0 {
+		logger.Printf("No media files found in %s/", opts.VideoDir)
+		return &BatchResult{}, nil
+	}
+
+	b, err := openBatch(opts, durations, logger)
+	if err != nil {
+		return nil, err
+	}
+	defer b.transcriber.Close()
+
+	return runPool(ctx, jobs, b), nil
+}
 
-	// Ensure required folders exist
-	for _, dir := range []string{videoDir, audioDir, ttsDir} {
+// ensureFolders creates the input and output folders that are missing.
+func ensureFolders(opts Options, logger *log.Logger) error {
+	for _, dir := range []string{opts.VideoDir, opts.AudioDir, opts.OutputDir} {
 		if _, err := os.Stat(dir); os.IsNotExist(err) {
 			if err := os.MkdirAll(dir, 0755); err != nil {
 				return fmt.Errorf("failed to create folder %s: %v", dir, err)
@@ -31,177 +97,496 @@ func ProcessAllVideos(logger *log.Logger) error {
 			logger.Printf("Created folder: %s", dir)
 		}
 	}
+	return nil
+}
 
-	// Read video files
-	files, err := os.ReadDir(videoDir)
-	if err != nil {
-		return fmt.Errorf("failed to read video folder: %v", err)
+// openBatch loads the folder's prompt and glossary, the manifest and the
+// model. The caller closes b.transcriber.
+func openBatch(opts Options, durations map[string]time.Duration, logger *log.Logger) (*batch, error) {
+	// VAD regions and chunks are decoded one by one, and each would be
+	// cut to the window again
+	if opts.Decode.windowed() && (opts.VAD.Enabled || opts.Chunk.Length > 0) {
+		return nil, fmt.Errorf("decode offset and duration cannot be combined with VAD or chunking")
 	}
 
-	if len(files) == 0 {
-		logger.Println("No video files found in Video/")
-		return nil
+	if err := opts.loadFolderContext(logger); err != nil {
+		return nil, err
 	}
 
-	// Process all video files
-	for _, file := range files {
-		if !file.IsDir() && (strings.HasSuffix(strings.ToLower(file.Name()), ".mp4") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".mov") ||
-			strings.HasSuffix(strings.ToLower(file.Name()), ".mkv")) {
+	manifest, err := LoadManifest(filepath.Join(opts.OutputDir, ManifestFile))
+	if err != nil {
+		return nil, err
+	}
 
-			videoPath := filepath.Join(videoDir, file.Name())
-			if err := ProcessSingleVideo(videoPath, audioDir, ttsDir, modelPath, logger); err != nil {
-				logger.Printf("Error processing %s: %v", file.Name(), err)
-			}
-		}
+	if opts.Index == nil {
+		opts.Index = openIndex(opts.OutputDir, logger)
 	}
 
-	return nil
+	// Load the model once for the whole batch
+	transcriber, err := NewWhisperTranscriber(opts.ModelPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &batch{
+		opts:        opts,
+		transcriber: transcriber,
+		manifest:    manifest,
+		progress:    newProgressTracker(opts.Progress, durations),
+		logger:      logger,
+	}, nil
 }
 
 // ProcessSingleVideo handles one video: extract audio, transcribe, save JSON
-func ProcessSingleVideo(videoPath, audioDir, ttsDir, modelPath string, logger *log.Logger) error {
-	videoName := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
-	audioFile := filepath.Join(audioDir, videoName+".wav")
-	jsonFile := filepath.Join(ttsDir, videoName+".json")
+func ProcessSingleVideo(videoPath, audioDir, ttsDir string, session Session, logger *log.Logger) error {
+	return ProcessSingleVideoContext(context.Background(), videoPath, audioDir, ttsDir, session, logger)
+}
 
-	// Skip if JSON already exists
-	if _, err := os.Stat(jsonFile); err == nil {
-		logger.Printf("Skipping %s (already processed)", videoName)
-		return nil
+// ProcessSingleVideoContext is ProcessSingleVideo with cancellation. On any
+// failure, including cancellation, the extracted audio and partial outputs
+// of this video are removed.
+func ProcessSingleVideoContext(ctx context.Context, videoPath, audioDir, ttsDir string, session Session, logger *log.Logger) error {
+	manifest, err := LoadManifest(filepath.Join(ttsDir, ManifestFile))
+	if err != nil {
+		return err
 	}
+	w := &worker{
+		batch: &batch{
+			opts:     Options{AudioDir: audioDir, OutputDir: ttsDir},
+			manifest: manifest,
+			logger:   logger,
+		},
+		session: session,
+	}
+	return w.process(ctx, videoPath, nil)
+}
 
-	logger.Printf("Processing video: %s", videoPath)
+// batch is the state shared by every worker of one run.
+type batch struct {
+	opts        Options
+	transcriber Transcriber
+	manifest    *Manifest
+	progress    *progressTracker
+	logger      *log.Logger
 
-	// Step 1: Extract audio with ffmpeg
-	cmd := exec.Command("ffmpeg", "-i", videoPath, "-ar", "16000", "-ac", "1", "-f", "wav", audioFile)
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to extract audio: %v", err)
+	// indexChanged is set when opts.Index has changes saveIndex has not
+	// written yet
+	indexChanged atomic.Bool
+}
+
+// worker holds the sessions one goroutine of the pool decodes with.
+type worker struct {
+	*batch
+	session Session
+
+	// translator decodes straight to English; nil unless opts.Translate
+	translator Session
+}
+
+// process handles one file and reports it to the progress tracker.
+func (w *worker) process(ctx context.Context, videoPath string, info *MediaInfo) error {
+	w.progress.begin(videoPath)
+	skipped, err := w.processFile(ctx, videoPath, info)
+	switch {
+	case err != nil:
+		w.progress.finish(videoPath, StageFailed)
+	case skipped:
+		w.progress.finish(videoPath, StageSkipped)
+	default:
+		w.progress.finish(videoPath, StageDone)
+	}
+	return err
+}
+
+// processFile extracts audio, transcribes and saves the outputs of one file,
+// probing it first unless the caller already did and passes info. It reports
+// whether the file was skipped as already processed.
+func (w *worker) processFile(ctx context.Context, videoPath string, info *MediaInfo) (skipped bool, err error) {
+	logger := w.logger
+	videoName := outputName(videoPath)
+	jsonFile := filepath.Join(w.opts.OutputDir, videoName+".json")
+	translationFile := filepath.Join(w.opts.OutputDir, videoName+TranslationSuffix+".json")
+
+	if info == nil {
+		if info, err = ProbeMedia(ctx, videoPath); err != nil {
+			return false, err
+		}
+	}
+	if !info.HasAudio {
+		return false, fmt.Errorf("no audio stream in %s", videoPath)
 	}
-	logger.Printf("Extracted audio: %s", audioFile)
 
-	// Step 2: Load Whisper model
-	model, err := whisper.New(modelPath)
+	// Skip if this exact content was already processed the same way
+	hash, stat, err := w.manifest.SourceHash(videoPath)
 	if err != nil {
-		return fmt.Errorf("failed to load model: %v", err)
+		return false, fmt.Errorf("failed to hash source: %v", err)
 	}
-	defer model.Close()
+	settings := w.opts.forFile(info.Duration).settings()
+	fingerprint := fingerprintOf(settings)
+	if w.manifest.UpToDate(videoPath, hash, w.opts.ModelPath, fingerprint) {
+		logger.Printf("Skipping %s (already processed)", videoName)
+		w.removeLegacyOutputs(videoPath)
+		return true, nil
+	}
+
+	logger.Printf("Processing: %s", videoPath)
 
-	// Step 3: Create a new context
-	ctx, err := model.NewContext()
+	// Remove everything this run produced unless it completes
+	var partials, outputs []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, path := range append(partials, outputs...) {
+			_ = os.Remove(path)
+		}
+		if ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+			err = fmt.Errorf("%w (%v)", ctx.Err(), err)
+		}
+	}()
+
+	// Steps 1-3: Decode and transcribe, long files in overlapping chunks
+	var transcript, translation *models.Transcript
+	var checkpoints string
+	if w.opts.Chunk.applies(info.Duration) {
+		checkpoints = w.checkpointDir(hash, fingerprint)
+		transcript, translation, err = w.transcribeChunked(ctx, videoPath, info, checkpoints)
+	} else {
+		var samples []float32
+		samples, err = w.decode(ctx, videoPath, info, &partials)
+		if err != nil {
+			return false, err
+		}
+		w.progress.update(videoPath, StageTranscribing, 0)
+		transcript, translation, err = w.transcribeBoth(withProgress(ctx, w.progress.progressFunc(videoPath, StageTranscribing)), videoName, samples)
+		if err == nil {
+			err = w.diarize(ctx, samples, transcript, translation)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("failed to create whisper context: %v", err)
+		return false, err
+	}
+	if transcript.LanguageProbability > 0 {
+		logger.Printf("Detected language %s (p=%.2f) for %s", transcript.Language, transcript.LanguageProbability, videoName)
 	}
 
-	// Step 2: Read wav to []float32 (resampling already done by ffmpeg above)
-	samples, sr, err := readWavToFloat32(audioFile)
+	// Step 4: Save JSON output, with what it was made from
+	source := models.TranscriptSource{Path: videoPath, SHA256: hash, Duration: info.Duration}
+	w.describe(transcript, source, settings)
+	if translation != nil {
+		w.describe(translation, source, settings)
+	}
+	outputs = append(outputs, jsonFile)
+	if err := writeTranscript(jsonFile, transcript); err != nil {
+		return false, err
+	}
+	logger.Printf("Saved transcription to: %s", jsonFile)
+
+	exported, err := export.WriteFiles(strings.TrimSuffix(jsonFile, ".json"), w.opts.Formats, transcript.Segments)
+	outputs = append(outputs, exported...)
 	if err != nil {
-		return fmt.Errorf("failed to read wav: %w", err)
-	}
-	if sr != 16000 {
-		// defensive: if sample rate is not 16k, resample using ffmpeg and re-read
-		logger.Printf("resampling audio from %d -> 16000", sr)
-		tmp := audioFile + ".16k.wav"
-		cmd := exec.Command("ffmpeg", "-y", "-i", audioFile, "-ar", "16000", "-ac", "1", tmp)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("ffmpeg resample failed: %w", err)
-		}
-		// replace audioFile and re-read
-		audioFile = tmp
-		samples, sr, err = readWavToFloat32(audioFile)
+		return false, err
+	}
+
+	// List the low-confidence ranges for the editors, if there are any
+	if w.opts.ReviewThreshold > 0 {
+		reviewFile := filepath.Join(w.opts.OutputDir, videoName+ReviewSuffix+".txt")
+		if ranges := ReviewRanges(transcript.Segments); len(ranges) > 0 {
+			outputs = append(outputs, reviewFile)
+			if err := writeReview(reviewFile, videoPath, w.opts.ReviewThreshold, ranges); err != nil {
+				return false, fmt.Errorf("failed to write review report: %v", err)
+			}
+			logger.Printf("Flagged %d range(s) for review in: %s", len(ranges), reviewFile)
+		} else {
+			// A report left from an earlier run would be stale now
+			_ = os.Remove(reviewFile)
+		}
+	}
+
+	// Step 5: Save the English translation next to the native transcript
+	if translation != nil {
+		outputs = append(outputs, translationFile)
+		if err := writeTranscript(translationFile, translation); err != nil {
+			return false, err
+		}
+		logger.Printf("Saved translation to: %s", translationFile)
+
+		exported, err := export.WriteFiles(strings.TrimSuffix(translationFile, ".json"), w.opts.Formats, translation.Segments)
+		outputs = append(outputs, exported...)
 		if err != nil {
-			return fmt.Errorf("failed to re-read resampled wav: %w", err)
+			return false, err
 		}
-		if sr != 16000 {
-			return fmt.Errorf("unexpected sample rate after resample: %d", sr)
+	}
+
+	// Step 6: Make the new transcripts searchable
+	w.index(jsonFile, transcript)
+	if translation != nil {
+		w.index(translationFile, translation)
+	}
+
+	// Step 7: Record the outputs so unchanged sources are skipped next time
+	err = w.manifest.Record(ManifestEntry{
+		Source:      videoPath,
+		SHA256:      hash,
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		Model:       w.opts.ModelPath,
+		Options:     fingerprint,
+		Outputs:     outputs,
+		ProcessedAt: time.Now(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if checkpoints != "" {
+		_ = os.RemoveAll(checkpoints)
+	}
+	w.removeLegacyOutputs(videoPath)
+	return false, nil
+}
+
+// removeLegacyOutputs deletes the outputs an older version wrote for
+// videoPath under its stem, now that outputs named after the whole file
+// exist, so they are not searched or served twice.
+func (w *worker) removeLegacyOutputs(videoPath string) {
+	for _, path := range legacyOutputs(w.opts.OutputDir, videoPath) {
+		if w.manifest.Owns(path) {
+			continue
 		}
+		if err := os.Remove(path); err != nil {
+			if !os.IsNotExist(err) {
+				w.logger.Printf("Failed to remove legacy output %s: %v", path, err)
+			}
+			continue
+		}
+		if w.opts.Index != nil {
+			w.opts.Index.Remove(path)
+			w.indexChanged.Store(true)
+		}
+		w.logger.Printf("Removed legacy output: %s", path)
 	}
+}
+
+// decode reads the audio of videoPath as 16 kHz mono samples. An extracted
+// WAV file is added to partials before it is written.
+func (w *worker) decode(ctx context.Context, videoPath string, info *MediaInfo, partials *[]string) ([]float32, error) {
+	logger := w.logger
+	report := w.progress.progressFunc(videoPath, StageDecoding)
+	switch {
+	case info.IsWav():
+		// Decoded and resampled in Go, without ffmpeg
+		return readWav16k(ctx, videoPath, logger)
+	case w.opts.InMemory:
+		// Stream PCM straight from ffmpeg, nothing touches the disk
+		samples, err := decodePCM(ctx, videoPath, info, report)
+		if err != nil {
+			return nil, err
+		}
+		logger.Printf("Decoded %s of audio in memory", samplesToDuration(len(samples)).Round(time.Second))
+		return samples, nil
+	default:
+		audioFile := filepath.Join(w.opts.AudioDir, outputName(videoPath)+".wav")
+		*partials = append(*partials, audioFile)
+		if err := extractAudio(ctx, videoPath, audioFile, info.Duration, report); err != nil {
+			return nil, err
+		}
+		logger.Printf("Extracted audio: %s", audioFile)
 
-	// Step 5: Run transcription
-	if err := ctx.Process(samples, nil, nil, nil); err != nil {
-		return fmt.Errorf("failed to process audio: %v", err)
+		// Read wav to []float32 (resampling already done by ffmpeg above)
+		return readWav16k(ctx, audioFile, logger)
 	}
+}
 
-	// Step 6: Collect results
-	var results []models.SegmentResult
-	for {
-		segment, err := ctx.NextSegment()
+// transcribeBoth transcribes samples, restricted to the speech regions if
+// VAD is on, and translates them when a translator is set and the language
+// is not English. translation is nil when there is none.
+func (w *worker) transcribeBoth(ctx context.Context, name string, samples []float32) (transcript, translation *models.Transcript, err error) {
+	var regions []SpeechRegion
+	if w.opts.VAD.Enabled {
+		regions = DetectSpeech(samples, w.opts.VAD)
+		var speech time.Duration
+		for _, r := range regions {
+			speech += r.Duration()
+		}
+		w.logger.Printf("VAD kept %d region(s), %s of %s", len(regions), speech.Round(time.Second), samplesToDuration(len(samples)).Round(time.Second))
+	}
+	if transcript, err = w.transcribe(ctx, w.session, samples, regions); err != nil {
+		return nil, nil, err
+	}
+
+	if w.translator == nil {
+		return transcript, nil, nil
+	}
+	if transcript.Language == "en" {
+		w.logger.Printf("Skipping translation of %s (already English)", name)
+		return transcript, nil, nil
+	}
+	if translation, err = w.transcribe(ctx, w.translator, samples, regions); err != nil {
+		return nil, nil, fmt.Errorf("failed to translate: %w", err)
+	}
+	translation.Language = transcript.Language
+	translation.LanguageProbability = transcript.LanguageProbability
+	translation.Translated = true
+	return transcript, translation, nil
+}
+
+// diarize labels the speakers of every non-nil transcript when a diarizer
+// is set.
+func (w *worker) diarize(ctx context.Context, samples []float32, transcripts ...*models.Transcript) error {
+	if w.opts.Diarizer == nil {
+		return nil
+	}
+	for _, transcript := range transcripts {
+		if transcript == nil {
+			continue
+		}
+		if err := w.opts.Diarizer.Diarize(ctx, samples, transcript.Segments); err != nil {
+			return fmt.Errorf("failed to diarize: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadFolderContext fills in the initial prompt and glossary from the video
+// folder where the options have none, then appends the glossary terms to the
+// prompt.
+func (o *Options) loadFolderContext(logger *log.Logger) error {
+	if o.Decode.InitialPrompt == "" {
+		prompt, err := readPrompt(filepath.Join(o.VideoDir, PromptFile))
 		if err != nil {
-			break // no more segments
+			return err
+		}
+		if prompt != "" {
+			logger.Printf("Using initial prompt from %s", filepath.Join(o.VideoDir, PromptFile))
+			o.Decode.InitialPrompt = prompt
+		}
+	}
+	if o.Glossary == nil {
+		path := filepath.Join(o.VideoDir, GlossaryFile)
+		if _, err := os.Stat(path); err == nil {
+			if o.Glossary, err = LoadGlossary(path); err != nil {
+				return err
+			}
+			logger.Printf("Using %d glossary term(s) from %s", len(o.Glossary.Entries), path)
 		}
-		results = append(results, models.SegmentResult{
-			Start: segment.Start,
-			End:   segment.End,
-			Text:  segment.Text,
-		})
 	}
+	o.Decode.InitialPrompt = o.Glossary.Prompt(o.Decode.InitialPrompt)
+	return nil
+}
 
-	// Step 7: Save JSON output
-	jsonData, err := json.MarshalIndent(results, "", "  ")
+// transcribe runs session over samples, restricted to regions when the
+// detector is enabled, then applies the glossary, the text transforms and
+// the review flags.
+func (w *worker) transcribe(ctx context.Context, session Session, samples []float32, regions []SpeechRegion) (*models.Transcript, error) {
+	var transcript *models.Transcript
+	var err error
+	if w.opts.VAD.Enabled {
+		transcript, err = transcribeSpeech(ctx, session, samples, regions, w.opts.VAD)
+	} else {
+		transcript, err = session.Transcribe(ctx, samples)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if w.opts.GlossaryReplace || len(w.opts.Transforms) > 0 {
+		postprocess.KeepRaw(transcript.Segments)
+	}
+	if w.opts.GlossaryReplace {
+		if n := w.opts.Glossary.Apply(transcript.Segments); n > 0 {
+			w.logger.Printf("Replaced %d glossary variant(s)", n)
+		}
+	}
+	w.opts.Transforms.Apply(transcript.Segments)
+
+	if w.opts.ReviewThreshold > 0 {
+		FlagForReview(transcript.Segments, w.opts.ReviewThreshold)
+	}
+	return transcript, nil
+}
+
+// describe records the source, model and settings behind transcript.
+func (w *worker) describe(transcript *models.Transcript, source models.TranscriptSource, settings []byte) {
+	transcript.Source = source
+	transcript.Model = filepath.Base(w.opts.ModelPath)
+	transcript.Options = settings
+	transcript.CreatedAt = time.Now()
+}
+
+// writeTranscript saves transcript as indented JSON.
+func writeTranscript(path string, transcript *models.Transcript) error {
+	jsonData, err := json.MarshalIndent(transcript, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %v", err)
 	}
 
-	if err := os.WriteFile(jsonFile, jsonData, 0644); err != nil {
+	if err := writeFileAtomic(path, jsonData); err != nil {
 		return fmt.Errorf("failed to write JSON file: %v", err)
 	}
-	logger.Printf("Saved transcription to: %s", jsonFile)
-
 	return nil
 }
 
-// readWavToFloat32 reads a wav file (PCM) and returns mono float32 samples and sample rate.
-// If the file has multiple channels it averages them into mono.
-// Uses go-audio/wav FullPCMBuffer to get PCM data. See package docs for FullPCMBuffer. :contentReference[oaicite:2]{index=2}
-func readWavToFloat32(path string) ([]float32, int, error) {
-	f, err := os.Open(path)
+// extractAudio has ffmpeg write the audio of src as a 16 kHz mono WAV to dst,
+// reporting the fraction of duration decoded to report, which may be nil.
+func extractAudio(ctx context.Context, src, dst string, duration time.Duration, report func(float64)) error {
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y", "-nostats", "-progress", "pipe:1",
+		"-i", src, "-vn", "-ar", "16000", "-ac", "1", "-f", "wav", dst)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, 0, fmt.Errorf("open wav: %w", err)
+		return err
 	}
-	defer f.Close()
-
-	dec := wav.NewDecoder(f)
-	if !dec.IsValidFile() {
-		return nil, 0, fmt.Errorf("invalid wav file: %s", path)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to extract audio: %v", err)
+	}
+	ffmpegProgress(stdout, duration, report, os.Stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to extract audio: %v", err)
 	}
+	return nil
+}
 
-	buf, err := dec.FullPCMBuffer()
+// readWav16k reads a wav file into mono samples, resampling it to 16 kHz
+// if needed. It needs no ffmpeg.
+func readWav16k(ctx context.Context, audioFile string, logger *log.Logger) ([]float32, error) {
+	samples, sr, err := readWavToFloat32(audioFile)
 	if err != nil {
-		return nil, 0, fmt.Errorf("reading full pcm buffer: %w", err)
+		return nil, fmt.Errorf("failed to read wav: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if sr != SampleRate {
+		logger.Printf("resampling audio from %d -> %d", sr, SampleRate)
+		samples = resample(samples, sr, SampleRate)
 	}
+	return samples, nil
+}
 
-	channels := buf.Format.NumChannels
-	sr := buf.Format.SampleRate
-	bitDepth := int(dec.SampleBitDepth())
-	if bitDepth == 0 {
-		// fallback to 16-bit if decoder can't tell us
-		bitDepth = 16
+// writeFileAtomic writes data next to path and renames it into place, so a
+// crash or cancellation never leaves a truncated output behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		_ = os.Remove(tmp)
+		return err
 	}
-	// scale factor to map integer PCM -> [-1.0, +1.0)
-	scale := float32((int(1) << (bitDepth - 1)))
+	return os.Rename(tmp, path)
+}
 
-	// buf.Data is interleaved samples (len = frames * channels)
-	if channels <= 1 {
-		samples := make([]float32, len(buf.Data))
-		for i, v := range buf.Data {
-			samples[i] = float32(v) / scale
-		}
-		return samples, sr, nil
+// readWavToFloat32 reads an integer (8/16/24/32-bit) or float (32/64-bit)
+// wav file and returns mono float32 samples and the sample rate. Channels
+// are averaged into mono, leaving out the LFE channel of surround layouts.
+func readWavToFloat32(path string) ([]float32, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("open wav: %w", err)
 	}
+	defer f.Close()
 
-	frames := len(buf.Data) / channels
-	samples := make([]float32, frames)
-	for i := 0; i < frames; i++ {
-		var sum int
-		for ch := 0; ch < channels; ch++ {
-			sum += buf.Data[i*channels+ch]
-		}
-		avg := float32(sum) / float32(channels)
-		samples[i] = avg / scale
+	samples, format, err := decodeWav(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid wav file %s: %w", path, err)
 	}
-	return samples, sr, nil
+	return samples, format.SampleRate, nil
 }
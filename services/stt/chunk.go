@@ -0,0 +1,269 @@
+package stt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"sts/internal/models"
+)
+
+// ChunkOptions splits long files into overlapping chunks that are decoded
+// and transcribed on their own, so memory stays bounded by the chunk length
+// and a failed run resumes from the chunks it already finished.
+type ChunkOptions struct {
+	// Length of every chunk without the overlap. Files no longer than
+	// Length+Overlap are transcribed whole; zero disables chunking.
+	Length time.Duration
+
+	// Overlap is the audio neighbouring chunks share, so a word cut at one
+	// chunk's end is heard whole by the next.
+	Overlap time.Duration
+
+	// Parallel is the number of chunks of a file worked on at once. whisper
+	// still takes turns on the shared model, so this mainly overlaps ffmpeg
+	// decoding with transcription.
+	Parallel int
+}
+
+// CheckpointDir is the folder inside the output folder that keeps the
+// finished chunks of files still being transcribed.
+const CheckpointDir = ".chunks"
+
+func (c ChunkOptions) applies(duration time.Duration) bool {
+	return c.Length > 0 && duration > c.Length+c.Overlap
+}
+
+// chunkSpan is the part of a file one chunk covers.
+type chunkSpan struct {
+	Start, End time.Duration
+}
+
+// spans cuts total into chunks starting every Length, each running Overlap
+// into the next one.
+func (c ChunkOptions) spans(total time.Duration) []chunkSpan {
+	var spans []chunkSpan
+	for start := time.Duration(0); ; start += c.Length {
+		end := min(start+c.Length+c.Overlap, total)
+		spans = append(spans, chunkSpan{Start: start, End: end})
+		if end == total {
+			return spans
+		}
+	}
+}
+
+// chunkResult is the checkpoint of one chunk, with times on the timeline of
+// the whole file. Translation is nil when the chunk was not translated.
+type chunkResult struct {
+	Start       time.Duration      `json:"start"`
+	End         time.Duration      `json:"end"`
+	Transcript  *models.Transcript `json:"transcript"`
+	Translation *models.Transcript `json:"translation,omitempty"`
+}
+
+// checkpointDir is where the chunks of a source are kept. The content hash
+// and options fingerprint are part of the name, so checkpoints of another
+// version of the file or other options are never picked up.
+func (w *worker) checkpointDir(hash, fingerprint string) string {
+	return filepath.Join(w.opts.OutputDir, CheckpointDir, hash[:16]+"-"+fingerprint)
+}
+
+// transcribeChunked transcribes videoPath chunk by chunk, reusing chunks
+// checkpointed in dir by an earlier run, and stitches the results.
+//
+// Diarization needs the audio of the whole file, which is what chunking
+// avoids holding, so chunked transcripts carry no speaker labels and the
+// options recorded with them have no Diarizer.
+func (w *worker) transcribeChunked(ctx context.Context, videoPath string, info *MediaInfo, dir string) (*models.Transcript, *models.Transcript, error) {
+	name := outputName(videoPath)
+	spans := w.opts.Chunk.spans(info.Duration)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create checkpoint folder: %v", err)
+	}
+
+	results := make([]*chunkResult, len(spans))
+	var todo []int
+	for i, span := range spans {
+		if r, ok := loadChunk(chunkFile(dir, i), span); ok {
+			results[i] = r
+		} else {
+			todo = append(todo, i)
+		}
+	}
+	if resumed := len(spans) - len(todo); resumed > 0 {
+		w.logger.Printf("Resuming %s at %d of %d chunks", name, resumed, len(spans))
+	} else {
+		w.logger.Printf("Transcribing %s in %d chunks of %s", name, len(spans), w.opts.Chunk.Length)
+	}
+	if w.opts.Diarizer != nil {
+		w.logger.Printf("Not labeling speakers of %s (chunked files are never held whole)", name)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	finished := len(spans) - len(todo)
+	w.progress.update(videoPath, StageTranscribing, float64(finished)/float64(len(spans)))
+
+	sem := make(chan struct{}, max(w.opts.Chunk.Parallel, 1))
+	var wg sync.WaitGroup
+	for _, i := range todo {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			r, err := w.transcribeChunk(ctx, videoPath, i, spans[i])
+			if err == nil {
+				err = saveChunk(chunkFile(dir, i), r)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("chunk %d of %d: %w", i+1, len(spans), err)
+					cancel()
+				}
+				return
+			}
+			results[i] = r
+			finished++
+			w.progress.update(videoPath, StageTranscribing, float64(finished)/float64(len(spans)))
+		}(i)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	transcript, translation := stitchChunks(spans, results)
+	return transcript, translation, nil
+}
+
+// transcribeChunk decodes only the audio of span and transcribes it.
+func (w *worker) transcribeChunk(ctx context.Context, videoPath string, i int, span chunkSpan) (*chunkResult, error) {
+	samples, err := decodePCMRange(ctx, videoPath, span.Start, span.End-span.Start, nil)
+	if err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("%s chunk %d", outputName(videoPath), i+1)
+	transcript, translation, err := w.transcribeBoth(ctx, name, samples)
+	if err != nil {
+		return nil, err
+	}
+	shiftSegments(transcript, span.Start)
+	shiftSegments(translation, span.Start)
+	return &chunkResult{Start: span.Start, End: span.End, Transcript: transcript, Translation: translation}, nil
+}
+
+// stitchChunks joins the chunks into one transcript and, if any chunk was
+// translated, one translation. Inside an overlap the cut is at its middle:
+// a segment belongs to the chunk its midpoint falls into, so the segments
+// both chunks heard are kept once. Untranslated chunks were English already
+// and fill the translation with their transcript.
+func stitchChunks(spans []chunkSpan, results []*chunkResult) (*models.Transcript, *models.Transcript) {
+	first := results[0].Transcript
+	transcript := &models.Transcript{Language: first.Language, LanguageProbability: first.LanguageProbability}
+	var translation *models.Transcript
+	for _, r := range results {
+		if r.Translation != nil {
+			translation = &models.Transcript{Language: first.Language, LanguageProbability: first.LanguageProbability, Translated: true}
+			break
+		}
+	}
+
+	for i, r := range results {
+		from, to := time.Duration(math.MinInt64), time.Duration(math.MaxInt64)
+		if i > 0 {
+			from = spans[i].Start + (spans[i-1].End-spans[i].Start)/2
+		}
+		if i < len(spans)-1 {
+			to = spans[i+1].Start + (spans[i].End-spans[i+1].Start)/2
+		}
+		keep := func(segments []models.SegmentResult) []models.SegmentResult {
+			var kept []models.SegmentResult
+			for _, seg := range segments {
+				if mid := seg.Start + (seg.End-seg.Start)/2; mid >= from && mid < to {
+					kept = append(kept, seg)
+				}
+			}
+			return kept
+		}
+
+		transcript.Segments = append(transcript.Segments, keep(r.Transcript.Segments)...)
+		if translation != nil {
+			source := r.Translation
+			if source == nil {
+				source = r.Transcript
+			}
+			translation.Segments = append(translation.Segments, keep(source.Segments)...)
+		}
+	}
+	return transcript, translation
+}
+
+// shiftSegments moves every time of transcript by offset.
+func shiftSegments(transcript *models.Transcript, offset time.Duration) {
+	if transcript == nil {
+		return
+	}
+	for i := range transcript.Segments {
+		seg := &transcript.Segments[i]
+		seg.Start += offset
+		seg.End += offset
+		for j := range seg.Words {
+			seg.Words[j].Start += offset
+			seg.Words[j].End += offset
+		}
+	}
+}
+
+func chunkFile(dir string, i int) string {
+	return filepath.Join(dir, fmt.Sprintf("chunk-%04d.json", i))
+}
+
+// loadChunk reads the checkpoint at path. Missing, unreadable or mismatched
+// checkpoints are reported as absent and simply redone.
+func loadChunk(path string, span chunkSpan) (*chunkResult, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	var r chunkResult
+	if err := json.Unmarshal(data, &r); err != nil || r.Transcript == nil {
+		return nil, false
+	}
+	if r.Start != span.Start || r.End != span.End {
+		return nil, false
+	}
+	return &r, true
+}
+
+func saveChunk(path string, r *chunkResult) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %v", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sts/internal/models"
+)
+
+func TestChunkSpans(t *testing.T) {
+	c := ChunkOptions{Length: 10 * time.Minute, Overlap: 10 * time.Second}
+	tests := []struct {
+		total time.Duration
+		want  []chunkSpan
+	}{
+		{25 * time.Minute, []chunkSpan{
+			{0, 10*time.Minute + 10*time.Second},
+			{10 * time.Minute, 20*time.Minute + 10*time.Second},
+			{20 * time.Minute, 25 * time.Minute},
+		}},
+		{20*time.Minute + 10*time.Second, []chunkSpan{
+			{0, 10*time.Minute + 10*time.Second},
+			{10 * time.Minute, 20*time.Minute + 10*time.Second},
+		}},
+	}
+	for _, tt := range tests {
+		got := c.spans(tt.total)
+		if len(got) != len(tt.want) {
+			t.Errorf("spans(%s) = %v, want %v", tt.total, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("spans(%s) = %v, want %v", tt.total, got, tt.want)
+				break
+			}
+		}
+	}
+
+	if c.applies(10*time.Minute + 10*time.Second) {
+		t.Error("chunking a file that fits in one chunk")
+	}
+	if !c.applies(10*time.Minute + 11*time.Second) {
+		t.Error("not chunking a file longer than a chunk")
+	}
+	if (ChunkOptions{}).applies(time.Hour) {
+		t.Error("chunking with chunks disabled")
+	}
+}
+
+func seg(start, end int, text string) models.SegmentResult {
+	return models.SegmentResult{Start: time.Duration(start) * time.Second, End: time.Duration(end) * time.Second, Text: text}
+}
+
+func texts(segments []models.SegmentResult) string {
+	var b bytes.Buffer
+	for _, s := range segments {
+		b.WriteString(s.Text)
+	}
+	return b.String()
+}
+
+func TestStitchChunks(t *testing.T) {
+	// The chunks overlap from 60s to 70s, so they are cut at 65s
+	spans := []chunkSpan{{0, 70 * time.Second}, {60 * time.Second, 130 * time.Second}}
+	results := []*chunkResult{
+		{
+			Transcript: &models.Transcript{Language: "fr", LanguageProbability: 0.9, Segments: []models.SegmentResult{
+				seg(0, 30, "a"), seg(58, 64, "b"), seg(63, 69, "c"),
+			}},
+			Translation: &models.Transcript{Language: "fr", Translated: true, Segments: []models.SegmentResult{
+				seg(0, 30, "A"), seg(58, 64, "B"), seg(63, 69, "C"),
+			}},
+		},
+		{
+			Transcript: &models.Transcript{Language: "en", Segments: []models.SegmentResult{
+				seg(60, 64, "b"), seg(63, 69, "c"), seg(100, 120, "d"),
+			}},
+		},
+	}
+
+	transcript, translation := stitchChunks(spans, results)
+	if got := texts(transcript.Segments); got != "abcd" {
+		t.Errorf("transcript = %q, want each segment once", got)
+	}
+	if transcript.Language != "fr" || transcript.LanguageProbability != 0.9 {
+		t.Errorf("language = %s (p=%v), want the first chunk's", transcript.Language, transcript.LanguageProbability)
+	}
+	if translation == nil || !translation.Translated {
+		t.Fatalf("translation = %+v", translation)
+	}
+	// The second chunk was not translated and fills in with its transcript
+	if got := texts(translation.Segments); got != "ABcd" {
+		t.Errorf("translation = %q", got)
+	}
+
+	results[0].Translation = nil
+	if _, translation := stitchChunks(spans, results); translation != nil {
+		t.Errorf("translation of untranslated chunks = %+v", translation)
+	}
+}
+
+func TestChunkedResumesFromCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.OutputDir = dir
+	opts.Chunk = ChunkOptions{Length: 10 * time.Second, Overlap: 2 * time.Second, Parallel: 2}
+	b := &batch{opts: opts, transcriber: &fakeTranscriber{}, logger: log.New(io.Discard, "", 0)}
+	w, err := newWorker(b, opts.Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info := &MediaInfo{Duration: 25 * time.Second, HasAudio: true}
+	checkpoints := filepath.Join(dir, CheckpointDir, "clip")
+	if err := os.MkdirAll(checkpoints, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i, span := range opts.Chunk.spans(info.Duration) {
+		text := string(rune('a' + i))
+		r := &chunkResult{Start: span.Start, End: span.End, Transcript: &models.Transcript{
+			Language: "en",
+			Segments: []models.SegmentResult{{Start: span.Start, End: span.Start + 5*time.Second, Text: text}},
+		}}
+		if err := saveChunk(chunkFile(checkpoints, i), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every chunk is checkpointed, so nothing is decoded again
+	transcript, translation, err := w.transcribeChunked(context.Background(), filepath.Join(dir, "clip.mp4"), info, checkpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := texts(transcript.Segments); got != "abc" || translation != nil {
+		t.Errorf("resumed transcript = %q, translation %+v", got, translation)
+	}
+}
+
+func TestLoadChunkRejectsStaleCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	span := chunkSpan{10 * time.Second, 22 * time.Second}
+	path := chunkFile(dir, 1)
+	r := &chunkResult{Start: span.Start, End: span.End, Transcript: &models.Transcript{Language: "en"}}
+	if err := saveChunk(path, r); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadChunk(path, span); !ok {
+		t.Error("checkpoint of the same span not loaded")
+	}
+	if _, ok := loadChunk(path, chunkSpan{10 * time.Second, 20 * time.Second}); ok {
+		t.Error("checkpoint of another span loaded")
+	}
+	if _, ok := loadChunk(chunkFile(dir, 2), span); ok {
+		t.Error("missing checkpoint loaded")
+	}
+	if err := os.WriteFile(path, []byte(`{"start":10000000000,"end":22000000000`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loadChunk(path, span); ok {
+		t.Error("truncated checkpoint loaded")
+	}
+}
+
+func TestChunkedSettingsLeaveDiarizerOut(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Chunk.Length = time.Minute
+	opts.Diarizer = NewClusterDiarizer(2)
+	without := opts
+	without.Diarizer = nil
+
+	long := opts.forFile(time.Hour)
+	if long.Diarizer != nil || !bytes.Equal(long.settings(), without.settings()) {
+		t.Error("chunked file settings include the diarizer")
+	}
+	if short := opts.forFile(30 * time.Second); bytes.Equal(short.settings(), without.settings()) {
+		t.Error("whole file settings leave the diarizer out")
+	}
+}
@@ -0,0 +1,373 @@
+package stt
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"sts/internal/models"
+)
+
+// Diarizer assigns speaker labels to the segments of a transcript.
+//
+// whisper.cpp can mark speaker turns itself with tinydiarize models. The
+// bindings have no setter for the tdrz flag or getter for the markers, but
+// cgo could reach both the way setBestOf does. Turns only say where the
+// speaker changes, not who speaks, and need a tdrz model, so labels come
+// from a separate stage that sees the audio and the segment timings.
+type Diarizer interface {
+	// Diarize sets Speaker on every segment it can place.
+	Diarize(ctx context.Context, samples []float32, segments []models.SegmentResult) error
+}
+
+// ClusterDiarizer labels segments by clustering a spectral voice print of
+// each one. It needs no extra model, which makes it a rough but dependency
+// free default; plug in a better Diarizer where accuracy matters.
+type ClusterDiarizer struct {
+	// MaxSpeakers caps the number of labels. Zero means no cap.
+	MaxSpeakers int
+
+	// Threshold is the cosine distance above which two clusters are kept
+	// apart. Lower values find more speakers.
+	Threshold float64
+}
+
+// Make sure ClusterDiarizer adheres to the interface
+var _ Diarizer = (*ClusterDiarizer)(nil)
+
+// NewClusterDiarizer returns a ClusterDiarizer with the default threshold.
+func NewClusterDiarizer(maxSpeakers int) *ClusterDiarizer {
+	return &ClusterDiarizer{MaxSpeakers: maxSpeakers, Threshold: 0.35}
+}
+
+const (
+	diarizeFrameLen = 512 // 32 ms at 16 kHz, a power of two for the FFT
+	diarizeHop      = 256
+	diarizeBands    = 24
+	diarizeCoeffs   = 12 // cepstral coefficients kept, c0 (loudness) dropped
+	diarizeMinFrame = 10 // segments with fewer voiced frames borrow a label
+)
+
+// Diarize clusters the voice prints of all segments agglomeratively.
+func (d *ClusterDiarizer) Diarize(ctx context.Context, samples []float32, segments []models.SegmentResult) error {
+	filters := melFilterbank(diarizeFrameLen, SampleRate, diarizeBands)
+
+	// Voice print of every segment long enough to have one
+	var prints [][]float64
+	var owners []int
+	for i, seg := range segments {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		start := min(max(durationToSamples(seg.Start), 0), len(samples))
+		end := min(max(durationToSamples(seg.End), start), len(samples))
+		if vp, ok := voicePrint(samples[start:end], filters); ok {
+			prints = append(prints, vp)
+			owners = append(owners, i)
+		}
+	}
+	if len(prints) == 0 {
+		return nil
+	}
+	normalizeColumns(prints)
+
+	clusters := d.cluster(prints)
+
+	// Number speakers in order of first appearance
+	names := map[int]string{}
+	for k, owner := range owners {
+		c := clusters[k]
+		if _, ok := names[c]; !ok {
+			names[c] = fmt.Sprintf("SPEAKER_%d", len(names)+1)
+		}
+		segments[owner].Speaker = names[c]
+	}
+
+	// Segments too short to fingerprint take the nearest earlier label
+	last := names[clusters[0]]
+	for i := range segments {
+		if segments[i].Speaker == "" {
+			segments[i].Speaker = last
+		}
+		last = segments[i].Speaker
+	}
+	return nil
+}
+
+// cluster returns the cluster index of every print using average linkage.
+//
+// The dendrogram is built with the nearest-neighbor chain algorithm in
+// O(n²) rather than by searching all pairs for every merge, which is O(n³)
+// and too slow for the thousands of segments of a long recording. Average
+// linkage never merges below an earlier merge, so replaying the merges from
+// the closest up gives the same clusters as merging greedily.
+func (d *ClusterDiarizer) cluster(prints [][]float64) []int {
+	n := len(prints)
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+		for j := 0; j < i; j++ {
+			dist[i][j] = cosineDistance(prints[i], prints[j])
+			dist[j][i] = dist[i][j]
+		}
+	}
+
+	// A merged cluster takes the place of its first half, so the cluster at
+	// i always contains print i
+	type merge struct {
+		a, b     int
+		distance float64
+	}
+	merges := make([]merge, 0, n-1)
+	size := make([]float64, n)
+	for i := range size {
+		size[i] = 1
+	}
+	var chain []int
+	for next := 0; len(merges) < n-1; {
+		if len(chain) == 0 {
+			for size[next] == 0 {
+				next++
+			}
+			chain = append(chain, next)
+		}
+
+		// Nearest neighbor of the chain's end, the previous link on ties so
+		// the chain always ends in a reciprocal pair
+		a := chain[len(chain)-1]
+		b, best := -1, math.Inf(1)
+		if len(chain) > 1 {
+			b = chain[len(chain)-2]
+			best = dist[a][b]
+		}
+		for k := 0; k < n; k++ {
+			if size[k] > 0 && k != a && dist[a][k] < best {
+				b, best = k, dist[a][k]
+			}
+		}
+		if len(chain) < 2 || b != chain[len(chain)-2] {
+			chain = append(chain, b)
+			continue
+		}
+		chain = chain[:len(chain)-2]
+
+		// Merge b into a, updating average linkage distances
+		for k := 0; k < n; k++ {
+			if size[k] == 0 || k == a || k == b {
+				continue
+			}
+			dist[a][k] = (dist[a][k]*size[a] + dist[b][k]*size[b]) / (size[a] + size[b])
+			dist[k][a] = dist[a][k]
+		}
+		size[a] += size[b]
+		size[b] = 0
+		merges = append(merges, merge{a, b, best})
+	}
+
+	sort.SliceStable(merges, func(i, j int) bool { return merges[i].distance < merges[j].distance })
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	alive := n
+	for _, m := range merges {
+		overCap := d.MaxSpeakers > 0 && alive > d.MaxSpeakers
+		if m.distance > d.Threshold && !overCap {
+			break
+		}
+		parent[find(m.b)] = find(m.a)
+		alive--
+	}
+
+	labels := make([]int, n)
+	for i := range labels {
+		labels[i] = find(i)
+	}
+	return labels
+}
+
+// voicePrint returns the mean and spread of the cepstrum over the voiced
+// frames of a segment.
+func voicePrint(samples []float32, filters [][]float64) ([]float64, bool) {
+	if len(samples) < diarizeFrameLen {
+		return nil, false
+	}
+
+	var frames [][]float64
+	var energies []float64
+	window := make([]complex128, diarizeFrameLen)
+	for start := 0; start+diarizeFrameLen <= len(samples); start += diarizeHop {
+		var energy float64
+		for i := 0; i < diarizeFrameLen; i++ {
+			hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(diarizeFrameLen-1))
+			v := float64(samples[start+i])
+			energy += v * v
+			window[i] = complex(v*hann, 0)
+		}
+		fft(window)
+
+		bands := make([]float64, len(filters))
+		for b, filter := range filters {
+			var sum float64
+			for k, weight := range filter {
+				if weight != 0 {
+					sum += weight * cmplx.Abs(window[k])
+				}
+			}
+			bands[b] = math.Log(sum + 1e-10)
+		}
+		frames = append(frames, dct(bands, diarizeCoeffs+1)[1:])
+		energies = append(energies, energy)
+	}
+
+	// Voiced frames are the louder half
+	median := medianOf(energies)
+	var voiced [][]float64
+	for i, f := range frames {
+		if energies[i] >= median && energies[i] > 0 {
+			voiced = append(voiced, f)
+		}
+	}
+	if len(voiced) < diarizeMinFrame {
+		return nil, false
+	}
+
+	vp := make([]float64, 2*diarizeCoeffs)
+	for _, f := range voiced {
+		for c, v := range f {
+			vp[c] += v / float64(len(voiced))
+		}
+	}
+	for _, f := range voiced {
+		for c, v := range f {
+			diff := v - vp[c]
+			vp[diarizeCoeffs+c] += diff * diff / float64(len(voiced))
+		}
+	}
+	for c := diarizeCoeffs; c < len(vp); c++ {
+		vp[c] = math.Sqrt(vp[c])
+	}
+	return vp, true
+}
+
+// melFilterbank returns triangular filters over the FFT bins up to Nyquist.
+func melFilterbank(frameLen, sampleRate, bands int) [][]float64 {
+	toMel := func(hz float64) float64 { return 2595 * math.Log10(1+hz/700) }
+	toHz := func(mel float64) float64 { return 700 * (math.Pow(10, mel/2595) - 1) }
+
+	low, high := toMel(80), toMel(7600)
+	edges := make([]float64, bands+2)
+	for i := range edges {
+		hz := toHz(low + (high-low)*float64(i)/float64(bands+1))
+		edges[i] = hz * float64(frameLen) / float64(sampleRate)
+	}
+
+	bins := frameLen/2 + 1
+	filters := make([][]float64, bands)
+	for b := range filters {
+		filters[b] = make([]float64, bins)
+		left, center, right := edges[b], edges[b+1], edges[b+2]
+		for k := 0; k < bins; k++ {
+			x := float64(k)
+			switch {
+			case x > left && x <= center:
+				filters[b][k] = (x - left) / (center - left)
+			case x > center && x < right:
+				filters[b][k] = (right - x) / (right - center)
+			}
+		}
+	}
+	return filters
+}
+
+// fft is an in-place radix-2 Cooley-Tukey transform; len(x) must be a power
+// of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// dct returns the first n DCT-II coefficients of x.
+func dct(x []float64, n int) []float64 {
+	out := make([]float64, n)
+	for k := range out {
+		var sum float64
+		for i, v := range x {
+			sum += v * math.Cos(math.Pi*float64(k)*(float64(i)+0.5)/float64(len(x)))
+		}
+		out[k] = sum
+	}
+	return out
+}
+
+// normalizeColumns z-scores every feature across all prints so no single
+// coefficient dominates the distance.
+func normalizeColumns(prints [][]float64) {
+	dims := len(prints[0])
+	for c := 0; c < dims; c++ {
+		var mean, variance float64
+		for _, p := range prints {
+			mean += p[c]
+		}
+		mean /= float64(len(prints))
+		for _, p := range prints {
+			variance += (p[c] - mean) * (p[c] - mean)
+		}
+		std := math.Sqrt(variance / float64(len(prints)))
+		for _, p := range prints {
+			if std > 0 {
+				p[c] = (p[c] - mean) / std
+			} else {
+				p[c] = 0
+			}
+		}
+	}
+}
+
+func cosineDistance(a, b []float64) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 1
+	}
+	return 1 - dot/math.Sqrt(na*nb)
+}
+
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
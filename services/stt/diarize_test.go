@@ -0,0 +1,167 @@
+package stt
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"sts/internal/models"
+)
+
+// greedyCluster is the plain O(n³) average linkage cluster replaces.
+func greedyCluster(d *ClusterDiarizer, prints [][]float64) []int {
+	n := len(prints)
+	members := make([][]int, n)
+	for i := range members {
+		members[i] = []int{i}
+	}
+	linkage := func(a, b []int) float64 {
+		var sum float64
+		for _, i := range a {
+			for _, j := range b {
+				sum += cosineDistance(prints[i], prints[j])
+			}
+		}
+		return sum / float64(len(a)*len(b))
+	}
+	for alive := n; alive > 1; alive-- {
+		bi, bj, best := -1, -1, math.Inf(1)
+		for i := range members {
+			for j := i + 1; j < n; j++ {
+				if members[i] != nil && members[j] != nil {
+					if dist := linkage(members[i], members[j]); dist < best {
+						bi, bj, best = i, j, dist
+					}
+				}
+			}
+		}
+		if best > d.Threshold && !(d.MaxSpeakers > 0 && alive > d.MaxSpeakers) {
+			break
+		}
+		members[bi] = append(members[bi], members[bj]...)
+		members[bj] = nil
+	}
+	labels := make([]int, n)
+	for c, m := range members {
+		for _, i := range m {
+			labels[i] = c
+		}
+	}
+	return labels
+}
+
+// samePartition reports whether two labelings group the items alike.
+func samePartition(a, b []int) bool {
+	ab, ba := map[int]int{}, map[int]int{}
+	for i := range a {
+		if x, ok := ab[a[i]]; ok && x != b[i] {
+			return false
+		}
+		if y, ok := ba[b[i]]; ok && y != a[i] {
+			return false
+		}
+		ab[a[i]], ba[b[i]] = b[i], a[i]
+	}
+	return true
+}
+
+func TestClusterMatchesGreedyLinkage(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 50; trial++ {
+		// A few speakers with prints scattered around their centers
+		speakers, n := 1+rng.Intn(4), 2+rng.Intn(40)
+		centers := make([][]float64, speakers)
+		for s := range centers {
+			centers[s] = make([]float64, 6)
+			for c := range centers[s] {
+				centers[s][c] = rng.NormFloat64()
+			}
+		}
+		prints := make([][]float64, n)
+		for i := range prints {
+			center := centers[rng.Intn(speakers)]
+			prints[i] = make([]float64, len(center))
+			for c := range center {
+				prints[i][c] = center[c] + 0.4*rng.NormFloat64()
+			}
+		}
+
+		d := &ClusterDiarizer{MaxSpeakers: rng.Intn(4), Threshold: 0.1 + 0.5*rng.Float64()}
+		got, want := d.cluster(prints), greedyCluster(d, prints)
+		if !samePartition(got, want) {
+			t.Fatalf("trial %d (%+v): clusters %v, greedy linkage %v", trial, d, got, want)
+		}
+	}
+}
+
+func TestClusterLimits(t *testing.T) {
+	prints := [][]float64{{1, 0}, {0.9, 0.1}, {0, 1}, {0.1, 0.9}, {-1, 0}}
+	count := func(labels []int) int {
+		seen := map[int]bool{}
+		for _, l := range labels {
+			seen[l] = true
+		}
+		return len(seen)
+	}
+	if got := count((&ClusterDiarizer{Threshold: 0.1}).cluster(prints)); got != 3 {
+		t.Errorf("threshold 0.1 found %d speakers, want 3", got)
+	}
+	if got := count((&ClusterDiarizer{Threshold: 0.1, MaxSpeakers: 2}).cluster(prints)); got != 2 {
+		t.Errorf("at most 2 speakers found %d", got)
+	}
+	if got := count((&ClusterDiarizer{Threshold: 2}).cluster(prints)); got != 1 {
+		t.Errorf("threshold 2 found %d speakers, want 1", got)
+	}
+	if got := (&ClusterDiarizer{}).cluster(prints[:1]); len(got) != 1 {
+		t.Errorf("single print labeled %v", got)
+	}
+}
+
+// voice is a harmonic signal with a pitch and a formant-like emphasis, a
+// crude stand-in for a speaker.
+func voice(rng *rand.Rand, length time.Duration, pitch, formant float64) []float32 {
+	samples := make([]float32, durationToSamples(length))
+	for i := range samples {
+		t := float64(i) / SampleRate
+		var v float64
+		for h := 1; float64(h)*pitch < 7000; h++ {
+			f := float64(h) * pitch
+			v += math.Exp(-math.Pow((f-formant)/500, 2)) * math.Sin(2*math.Pi*f*t)
+		}
+		samples[i] = float32(0.2*v + 0.01*rng.NormFloat64())
+	}
+	return samples
+}
+
+func TestDiarizeAlternatingSpeakers(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var samples []float32
+	var segments []models.SegmentResult
+	for i := 0; i < 6; i++ {
+		pitch, formant := 110.0, 700.0
+		if i%2 == 1 {
+			pitch, formant = 220, 2500
+		}
+		start := samplesToDuration(len(samples))
+		samples = append(samples, voice(rng, time.Second, pitch, formant)...)
+		segments = append(segments, models.SegmentResult{Start: start, End: samplesToDuration(len(samples))})
+	}
+	// Too short for a voice print, it takes the label before it
+	segments = append(segments, models.SegmentResult{Start: segments[5].End - 10*time.Millisecond, End: segments[5].End})
+
+	if err := NewClusterDiarizer(4).Diarize(context.Background(), samples, segments); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"SPEAKER_1", "SPEAKER_2", "SPEAKER_1", "SPEAKER_2", "SPEAKER_1", "SPEAKER_2", "SPEAKER_2"}
+	for i, seg := range segments {
+		if seg.Speaker != want[i] {
+			var got []string
+			for _, s := range segments {
+				got = append(got, s.Speaker)
+			}
+			t.Fatalf("speakers %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package stt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"sts/internal/models"
+)
+
+// GlossaryFile and PromptFile are picked up from the video folder when the
+// options bring no glossary or initial prompt of their own. The leading dot
+// keeps them out of the input listing.
+const (
+	GlossaryFile = ".glossary"
+	PromptFile   = ".prompt"
+)
+
+// GlossaryEntry is a term as it should be spelled, with the ways whisper is
+// known to mishear it.
+type GlossaryEntry struct {
+	Term     string   `json:"term"`
+	Variants []string `json:"variants,omitempty"`
+}
+
+// Glossary holds the domain terms of a job. The terms prime whisper through
+// the initial prompt; the variants can additionally be replaced in the
+// finished transcript.
+type Glossary struct {
+	Entries []GlossaryEntry
+
+	patterns []*regexp.Regexp // per entry, nil when it has no variants
+}
+
+// NewGlossary compiles the variant patterns of entries.
+func NewGlossary(entries []GlossaryEntry) *Glossary {
+	g := &Glossary{Entries: entries, patterns: make([]*regexp.Regexp, len(entries))}
+	for i, entry := range entries {
+		var alternatives []string
+		for _, variant := range entry.Variants {
+			// Any run of whitespace matches, so "PAD by  LOD" is found too
+			words := strings.Fields(variant)
+			for j, word := range words {
+				words[j] = regexp.QuoteMeta(word)
+			}
+			if len(words) > 0 {
+				alternatives = append(alternatives, strings.Join(words, `\s+`))
+			}
+		}
+		if len(alternatives) > 0 {
+			g.patterns[i] = regexp.MustCompile(`(?i)\b(?:` + strings.Join(alternatives, "|") + `)\b`)
+		}
+	}
+	return g
+}
+
+// ParseGlossary reads one entry per line, the term optionally followed by a
+// colon and comma separated variants:
+//
+//	# comment
+//	PathPilot: PAD by LOD, path pilot
+//	Selamot Umar Arto
+func ParseGlossary(r io.Reader) (*Glossary, error) {
+	var entries []GlossaryEntry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		term, variants, _ := strings.Cut(line, ":")
+		entry := GlossaryEntry{Term: strings.TrimSpace(term)}
+		if entry.Term == "" {
+			return nil, fmt.Errorf("line %d: missing term", n)
+		}
+		for _, variant := range strings.Split(variants, ",") {
+			if variant = strings.TrimSpace(variant); variant != "" {
+				entry.Variants = append(entry.Variants, variant)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewGlossary(entries), nil
+}
+
+// LoadGlossary reads the glossary file at path.
+func LoadGlossary(path string) (*Glossary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open glossary: %v", err)
+	}
+	defer f.Close()
+
+	g, err := ParseGlossary(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse glossary %s: %v", path, err)
+	}
+	return g, nil
+}
+
+// Prompt appends the glossary terms to prompt. whisper takes the prompt as
+// text that came before the audio and keeps only its tail when it is longer
+// than half the text context (about 224 tokens), so the terms go last.
+func (g *Glossary) Prompt(prompt string) string {
+	if g == nil || len(g.Entries) == 0 {
+		return prompt
+	}
+	terms := make([]string, len(g.Entries))
+	for i, entry := range g.Entries {
+		terms[i] = entry.Term
+	}
+	glossary := strings.Join(terms, ", ") + "."
+	if prompt = strings.TrimSpace(prompt); prompt == "" {
+		return glossary
+	}
+	return prompt + " " + glossary
+}
+
+// Apply replaces every known variant in the segment texts with its term and
+// returns the number of replacements. Words keep whisper's tokens, and a
+// variant split across two segments is not found.
+func (g *Glossary) Apply(segments []models.SegmentResult) int {
+	if g == nil {
+		return 0
+	}
+	count := 0
+	for i := range segments {
+		for k, pattern := range g.patterns {
+			if pattern == nil {
+				continue
+			}
+			term := g.Entries[k].Term
+			segments[i].Text = pattern.ReplaceAllStringFunc(segments[i].Text, func(string) string {
+				count++
+				return term
+			})
+		}
+	}
+	return count
+}
+
+// readPrompt returns the trimmed content of a prompt file, or "" if there is
+// none.
+func readPrompt(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,176 @@
+package stt
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sts/internal/models"
+)
+
+func TestParseGlossary(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []GlossaryEntry
+		wantErr string
+	}{
+		{
+			name: "terms and variants",
+			text: "# product names\n\nPathPilot: PAD by LOD,  path pilot ,\n  Selamot Umar Arto  \nKubernetes:\n",
+			want: []GlossaryEntry{
+				{Term: "PathPilot", Variants: []string{"PAD by LOD", "path pilot"}},
+				{Term: "Selamot Umar Arto"},
+				{Term: "Kubernetes"},
+			},
+		},
+		{name: "empty", text: "# nothing yet\n"},
+		{name: "missing term", text: "PathPilot\n: path pilot\n", wantErr: "line 2: missing term"},
+	}
+	for _, tt := range tests {
+		g, err := ParseGlossary(strings.NewReader(tt.text))
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(g.Entries, tt.want) {
+			t.Errorf("%s: entries = %+v, want %+v", tt.name, g.Entries, tt.want)
+		}
+	}
+}
+
+func TestLoadGlossary(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "terms.txt")
+	if err := os.WriteFile(path, []byte("PathPilot: path pilot\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := LoadGlossary(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Entries) != 1 || g.Entries[0].Term != "PathPilot" {
+		t.Errorf("entries = %+v", g.Entries)
+	}
+
+	if _, err := LoadGlossary(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("missing glossary loaded")
+	}
+	bad := filepath.Join(dir, "bad.txt")
+	if err := os.WriteFile(bad, []byte(":variant\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadGlossary(bad); err == nil || !strings.Contains(err.Error(), bad) {
+		t.Errorf("error = %v, want one naming %s", err, bad)
+	}
+}
+
+func TestGlossaryApply(t *testing.T) {
+	g := NewGlossary([]GlossaryEntry{
+		{Term: "PathPilot", Variants: []string{"PAD by LOD", "path pilot"}},
+		{Term: "C++", Variants: []string{"C plus plus"}},
+		{Term: "Kubernetes"},
+	})
+	segments := []models.SegmentResult{
+		{Text: "Open pad by\tlod, then Path Pilot."},
+		{Text: "It is written in c plus plus"},
+		{Text: "padbylod and path pilots stay"},
+	}
+	if n := g.Apply(segments); n != 3 {
+		t.Errorf("replaced %d variants, want 3", n)
+	}
+	want := []string{"Open PathPilot, then PathPilot.", "It is written in C++", "padbylod and path pilots stay"}
+	for i, seg := range segments {
+		if seg.Text != want[i] {
+			t.Errorf("segment %d = %q, want %q", i, seg.Text, want[i])
+		}
+	}
+
+	var none *Glossary
+	if n := none.Apply(segments); n != 0 {
+		t.Errorf("nil glossary replaced %d", n)
+	}
+}
+
+func TestGlossaryPrompt(t *testing.T) {
+	g := NewGlossary([]GlossaryEntry{{Term: "PathPilot"}, {Term: "Selamot"}})
+	tests := []struct {
+		glossary *Glossary
+		prompt   string
+		want     string
+	}{
+		{nil, "A talk.", "A talk."},
+		{NewGlossary(nil), "A talk.", "A talk."},
+		{g, "", "PathPilot, Selamot."},
+		{g, "  A talk.  ", "A talk. PathPilot, Selamot."},
+	}
+	for _, tt := range tests {
+		if got := tt.glossary.Prompt(tt.prompt); got != tt.want {
+			t.Errorf("Prompt(%q) = %q, want %q", tt.prompt, got, tt.want)
+		}
+	}
+}
+
+func TestLoadFolderContext(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	load := func(opts Options) Options {
+		t.Helper()
+		opts.VideoDir = dir
+		if err := opts.loadFolderContext(logger); err != nil {
+			t.Fatal(err)
+		}
+		return opts
+	}
+
+	// Nothing in the folder leaves the options alone
+	if got := load(Options{}); got.Decode.InitialPrompt != "" || got.Glossary != nil {
+		t.Errorf("empty folder gave prompt %q, glossary %+v", got.Decode.InitialPrompt, got.Glossary)
+	}
+
+	write(PromptFile, "\n A weekly product demo. \n")
+	write(GlossaryFile, "PathPilot: path pilot\n")
+
+	got := load(Options{})
+	if got.Decode.InitialPrompt != "A weekly product demo. PathPilot." {
+		t.Errorf("folder prompt = %q", got.Decode.InitialPrompt)
+	}
+	if got.Glossary == nil || got.Glossary.Entries[0].Term != "PathPilot" {
+		t.Errorf("folder glossary = %+v", got.Glossary)
+	}
+
+	// The options' own prompt and glossary win over the folder's
+	var own Options
+	own.Decode.InitialPrompt = "An interview."
+	own.Glossary = NewGlossary([]GlossaryEntry{{Term: "Selamot"}})
+	got = load(own)
+	if got.Decode.InitialPrompt != "An interview. Selamot." {
+		t.Errorf("own prompt = %q", got.Decode.InitialPrompt)
+	}
+	if got.Glossary.Entries[0].Term != "Selamot" {
+		t.Errorf("own glossary replaced by %+v", got.Glossary)
+	}
+
+	write(GlossaryFile, ": no term\n")
+	opts := Options{VideoDir: dir}
+	if err := opts.loadFolderContext(logger); err == nil {
+		t.Error("invalid folder glossary accepted")
+	}
+}
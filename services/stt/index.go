@@ -0,0 +1,56 @@
+package stt
+
+import (
+	"log"
+	"path/filepath"
+
+	"sts/internal/models"
+	"sts/services/search"
+)
+
+// openIndex opens the search index of dir and indexes the transcripts that
+// were written or changed since it was last saved. Search is a convenience,
+// so a broken index is logged and the batch runs without one.
+func openIndex(dir string, logger *log.Logger) *search.Index {
+	idx, err := search.Open(filepath.Join(dir, search.IndexFile))
+	if err != nil {
+		logger.Printf("Search index disabled: %v", err)
+		return nil
+	}
+	n, err := idx.Update(dir, ManifestFile)
+	if err != nil {
+		logger.Printf("Failed to update search index: %v", err)
+	}
+	if n > 0 {
+		logger.Printf("Indexed %d transcript(s) for search", n)
+		if err := idx.Save(); err != nil {
+			logger.Printf("Failed to save search index: %v", err)
+		}
+	}
+	return idx
+}
+
+// index adds a transcript just written to path to the search index. The
+// index is written to disk by saveIndex, not after every file, as saving
+// rewrites all of it.
+func (w *worker) index(path string, transcript *models.Transcript) {
+	if w.opts.Index == nil {
+		return
+	}
+	if err := w.opts.Index.Add(path, transcript); err != nil {
+		w.logger.Printf("Failed to index %s: %v", path, err)
+		return
+	}
+	w.indexChanged.Store(true)
+}
+
+// saveIndex writes the search index if transcripts were added or removed
+// since it was last saved.
+func (b *batch) saveIndex() {
+	if b.opts.Index == nil || !b.indexChanged.Swap(false) {
+		return
+	}
+	if err := b.opts.Index.Save(); err != nil {
+		b.logger.Printf("Failed to save search index: %v", err)
+	}
+}
@@ -0,0 +1,298 @@
+package stt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sts/internal/models"
+	"sts/services/export"
+	"sts/services/search"
+)
+
+// ManifestFile is the name of the manifest inside the output folder.
+const ManifestFile = "manifest.json"
+
+// ManifestEntry records what produced the outputs of one source file.
+type ManifestEntry struct {
+	Source      string    `json:"source"`
+	SHA256      string    `json:"sha256"`
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	Model       string    `json:"model"`
+	Options     string    `json:"options"`
+	Outputs     []string  `json:"outputs"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+// Manifest is the processing record of an output folder, keyed by source
+// path. A source is only processed again when its content, the model or
+// the output-affecting options change, or when one of its outputs is gone.
+type Manifest struct {
+	path string
+	mu   sync.Mutex
+
+	Entries map[string]ManifestEntry `json:"entries"`
+}
+
+// LoadManifest reads the manifest at path. A missing file yields an empty
+// manifest that is created on the first Record.
+func LoadManifest(path string) (*Manifest, error) {
+	m := &Manifest{path: path, Entries: map[string]ManifestEntry{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %v", err)
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+	if m.Entries == nil {
+		m.Entries = map[string]ManifestEntry{}
+	}
+	return m, nil
+}
+
+// SourceHash returns the content hash of source and the file info it was
+// taken with. The recorded hash is reused while the file keeps the size and
+// modification time it had when recorded, so unchanged sources are not read.
+func (m *Manifest) SourceHash(source string) (string, os.FileInfo, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return "", nil, err
+	}
+	if entry, ok := m.Lookup(source); ok && entry.SHA256 != "" &&
+		entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+		return entry.SHA256, info, nil
+	}
+	hash, err := hashFile(source)
+	return hash, info, err
+}
+
+// Owns reports whether path is an output recorded for any source.
+func (m *Manifest) Owns(path string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	path = filepath.Clean(path)
+	for _, entry := range m.Entries {
+		for _, output := range entry.Outputs {
+			if filepath.Clean(output) == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// UpToDate reports whether source was already processed from the same
+// content with the same model and options, and all its outputs still exist.
+func (m *Manifest) UpToDate(source, hash, model, options string) bool {
+	m.mu.Lock()
+	entry, ok := m.Entries[filepath.Clean(source)]
+	m.mu.Unlock()
+
+	if !ok || entry.SHA256 != hash || entry.Model != model || entry.Options != options {
+		return false
+	}
+	for _, output := range entry.Outputs {
+		if _, err := os.Stat(output); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup returns the entry recorded for source.
+func (m *Manifest) Lookup(source string) (ManifestEntry, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry, ok := m.Entries[filepath.Clean(source)]
+	return entry, ok
+}
+
+// Record stores entry and saves the manifest.
+func (m *Manifest) Record(entry ManifestEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.Source = filepath.Clean(entry.Source)
+	m.Entries[entry.Source] = entry
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	if err := writeFileAtomic(m.path, data); err != nil {
+		return fmt.Errorf("failed to write manifest: %v", err)
+	}
+	return nil
+}
+
+// hashFile returns the hex SHA-256 of the file's content.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// outputName is the stem every output of a source is named after. It keeps
+// the source extension so clip.mp4 and clip.mov never share outputs.
+func outputName(sourcePath string) string {
+	return filepath.Base(sourcePath)
+}
+
+// legacyOutputs lists the outputs an older version wrote for sourcePath
+// in dir, named after the stem alone: the transcript, its translation and
+// their exports. A transcript is only listed when it reads back as a bare
+// segment array or a version 1 document, and its exports only with it, so
+// files that merely share the name, such as the manifest, are never listed.
+func legacyOutputs(dir, sourcePath string) []string {
+	name := outputName(sourcePath)
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	if stem == name || stem == "" {
+		return nil
+	}
+	var paths []string
+	for _, base := range []string{stem, stem + TranslationSuffix} {
+		transcript := filepath.Join(dir, base+".json")
+		if stateFile(base+".json") || !isLegacyTranscript(transcript) {
+			continue
+		}
+		paths = append(paths, transcript)
+		for _, format := range export.AllFormats {
+			if file := base + "." + string(format); !stateFile(file) {
+				paths = append(paths, filepath.Join(dir, file))
+			}
+		}
+	}
+	return paths
+}
+
+// stateFile reports whether name is one of the files the service keeps
+// next to the transcripts rather than an output of a single source.
+func stateFile(name string) bool {
+	return name == ManifestFile || name == search.IndexFile || name == CheckpointDir ||
+		strings.HasSuffix(name, ReviewSuffix+".txt")
+}
+
+// isLegacyTranscript reports whether path holds a transcript in one of the
+// formats written before outputs kept the source extension: a bare array
+// of segments, or an object with only the version 1 fields.
+func isLegacyTranscript(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var segments []models.SegmentResult
+		return json.Unmarshal(data, &segments) == nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	if _, ok := fields["segments"]; !ok {
+		return false
+	}
+	for key := range fields {
+		switch key {
+		case "language", "language_probability", "translated", "segments":
+		default:
+			return false
+		}
+	}
+	var legacy struct {
+		Segments []models.SegmentResult `json:"segments"`
+	}
+	return json.Unmarshal(data, &legacy) == nil
+}
+
+// fingerprintOf hashes the settings of a file into the short fingerprint the
+// manifest and checkpoints are keyed on.
+func fingerprintOf(settings []byte) string {
+	sum := sha256.Sum256(settings)
+	return hex.EncodeToString(sum[:8])
+}
+
+// forFile returns the options that actually apply to a file of duration.
+// Chunked files are never diarized, so their settings leave the Diarizer
+// out and adding or changing one does not redo them.
+func (o Options) forFile(duration time.Duration) Options {
+	if o.Chunk.applies(duration) {
+		o.Diarizer = nil
+	}
+	return o
+}
+
+// settings is the JSON of every option that changes what ends up in the
+// outputs. Threads and worker counts only change speed and are left out.
+func (o Options) settings() []byte {
+	decode := o.Decode
+	decode.Threads = 0
+
+	vad := o.VAD
+	if !vad.Enabled {
+		vad = VADOptions{}
+	}
+
+	diarizer := ""
+	if o.Diarizer != nil {
+		diarizer = fmt.Sprintf("%T%+v", o.Diarizer, o.Diarizer)
+	}
+
+	// The glossary terms are already part of the prompt
+	var replacements []GlossaryEntry
+	if o.GlossaryReplace && o.Glossary != nil {
+		replacements = o.Glossary.Entries
+	}
+
+	// Chunk boundaries move segment edges; parallelism changes nothing
+	var chunk *ChunkOptions
+	if o.Chunk.Length > 0 {
+		chunk = &ChunkOptions{Length: o.Chunk.Length, Overlap: o.Chunk.Overlap}
+	}
+
+	data, _ := json.Marshal(struct {
+		Decode    DecodeOptions
+		Translate bool
+		VAD       VADOptions
+		Diarizer  string
+		Formats   []string
+		Glossary  []GlossaryEntry `json:",omitempty"`
+		Review    float32         `json:",omitempty"`
+		Chunk     *ChunkOptions   `json:",omitempty"`
+		Transform string          `json:",omitempty"`
+	}{decode, o.Translate, vad, diarizer, formatNames(o), replacements, o.ReviewThreshold, chunk, o.Transforms.String()})
+	return data
+}
+
+func formatNames(o Options) []string {
+	names := make([]string, len(o.Formats))
+	for i, f := range o.Formats {
+		names[i] = string(f)
+	}
+	return names
+}
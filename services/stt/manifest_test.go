@@ -0,0 +1,157 @@
+package stt
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"sts/services/search"
+)
+
+func TestSourceHashReusesRecordedHash(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "clip.wav")
+	if err := os.WriteFile(source, []byte("audio"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, info, err := m.SourceHash(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := hashFile(source); hash != want {
+		t.Fatalf("hash = %s, want %s", hash, want)
+	}
+
+	// A recorded hash is trusted while size and modification time match,
+	// so a made-up one shows that the file was not read
+	recorded := ManifestEntry{Source: source, SHA256: "recorded", Size: info.Size(), ModTime: info.ModTime()}
+	if err := m.Record(recorded); err != nil {
+		t.Fatal(err)
+	}
+	if hash, _, _ := m.SourceHash(source); hash != "recorded" {
+		t.Errorf("unchanged source was hashed again: %s", hash)
+	}
+
+	touched := info.ModTime().Add(time.Second)
+	if err := os.Chtimes(source, touched, touched); err != nil {
+		t.Fatal(err)
+	}
+	if hash, _, _ := m.SourceHash(source); hash == "recorded" {
+		t.Error("touched source was not hashed again")
+	}
+}
+
+func TestRemoveLegacyOutputs(t *testing.T) {
+	dir := t.TempDir()
+	legacy := []string{"clip.json", "clip.srt", "clip.en.json"}
+	kept := []string{"clip.mp4.json", "clip.mp4.srt", "other.json"}
+	for _, name := range append(legacy, kept...) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("[]"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, err := LoadManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &worker{batch: &batch{opts: Options{OutputDir: dir}, manifest: m, logger: log.New(io.Discard, "", 0)}}
+
+	w.removeLegacyOutputs(filepath.Join("Video", "clip.mp4"))
+	for _, name := range legacy {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("legacy output %s was kept", name)
+		}
+	}
+	for _, name := range kept {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("output %s was removed", name)
+		}
+	}
+}
+
+func TestRemoveLegacyOutputsKeepsStateFiles(t *testing.T) {
+	dir := t.TempDir()
+	m, err := LoadManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Record(ManifestEntry{Source: "Video/other.wav", SHA256: "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		search.IndexFile: `{}`,
+		// Written by this version, not a legacy transcript
+		"talk.json": `{"version":2,"segments":[]}`,
+		// Same fields as a version 1 transcript plus others
+		"notes.json": `{"segments":[],"author":"me"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w := &worker{batch: &batch{opts: Options{OutputDir: dir}, manifest: m, logger: log.New(io.Discard, "", 0)}}
+
+	for _, source := range []string{"manifest.wav", "search-index.mp4", "talk.mp4", "notes.mp3"} {
+		w.removeLegacyOutputs(filepath.Join("Video", source))
+	}
+	for _, name := range []string{ManifestFile, search.IndexFile, "talk.json", "notes.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was removed", name)
+		}
+	}
+	reloaded, err := LoadManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Lookup("Video/other.wav"); !ok {
+		t.Error("manifest lost its entries")
+	}
+}
+
+func TestProcessSourceNamedManifest(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.VideoDir = filepath.Join(dir, "Video")
+	opts.OutputDir = filepath.Join(dir, "stt")
+	for _, d := range []string{opts.VideoDir, opts.OutputDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := filepath.Join(opts.VideoDir, "manifest.wav")
+	writeTestWav(t, source, SampleRate, make([]int16, SampleRate))
+
+	manifest, err := LoadManifest(filepath.Join(opts.OutputDir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &batch{opts: opts, transcriber: &fakeTranscriber{}, manifest: manifest, logger: log.New(io.Discard, "", 0)}
+	w, err := newWorker(b, opts.Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.processFile(context.Background(), source, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := LoadManifest(filepath.Join(opts.OutputDir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := reloaded.Lookup(source); !ok {
+		t.Fatal("manifest was removed after processing manifest.wav")
+	}
+	if skipped, err := w.processFile(context.Background(), source, nil); err != nil || !skipped {
+		t.Errorf("second run: skipped %v, error %v", skipped, err)
+	}
+}
@@ -0,0 +1,250 @@
+package stt
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"sts/services/export"
+	"sts/services/postprocess"
+	"sts/services/search"
+)
+
+// Options configures a batch run over the video folder.
+type Options struct {
+	VideoDir  string
+	AudioDir  string
+	OutputDir string
+	ModelPath string
+
+	// Workers is the number of files processed concurrently. whisper
+	// decodes one file at a time, so extra workers only overlap audio
+	// extraction, diarization and output writing with it.
+	Workers int
+
+	// InMemory streams raw PCM from ffmpeg's stdout instead of writing a
+	// WAV file into AudioDir and reading it back.
+	InMemory bool
+
+	// Formats are written next to every JSON transcript, e.g. <name>.srt.
+	Formats []export.Format
+
+	// Chunk transcribes files longer than Chunk.Length in overlapping
+	// chunks with checkpoints under OutputDir/.chunks.
+	Chunk ChunkOptions
+
+	// VAD restricts transcription to the detected speech regions.
+	VAD VADOptions
+
+	// Diarizer labels the speaker of every segment when set, in the
+	// transcript and its translation alike.
+	Diarizer Diarizer
+
+	// Translate additionally writes an English translation of every
+	// non-English video to <name>.en.json, keeping the original timings.
+	// It needs a multilingual model.
+	Translate bool
+
+	// Glossary primes whisper with the domain terms of the job. When nil,
+	// GlossaryFile in VideoDir is used if present.
+	Glossary *Glossary
+
+	// GlossaryReplace also replaces the known misspellings of glossary
+	// terms in the finished transcripts.
+	GlossaryReplace bool
+
+	// Transforms clean up the text of every segment. The text whisper
+	// produced is kept in RawText.
+	Transforms postprocess.Chain
+
+	// ReviewThreshold flags segments whose average token probability is
+	// below it for human review and writes <name>.review.txt listing the
+	// flagged ranges. Zero disables flagging.
+	ReviewThreshold float32
+
+	// Index receives every transcript and translation written, so they are
+	// searchable as soon as they are done. It is saved when the batch ends,
+	// or between scans when watching. When nil, the index in OutputDir is
+	// opened and brought up to date at the start of the batch.
+	Index *search.Index
+
+	// Progress receives per-file and batch progress events when set.
+	Progress ProgressFunc
+
+	// FileTimeout bounds the processing of every single file. Zero means no
+	// limit beyond the batch context.
+	FileTimeout time.Duration
+
+	// Decode is applied to every worker's session. A zero Threads value
+	// gives every session all CPUs, since sessions never decode at once.
+	Decode DecodeOptions
+}
+
+// DecodeOptions configures a single decoding session.
+type DecodeOptions struct {
+	// Threads is the number of CPU threads whisper uses for this session.
+	Threads uint `json:",omitempty"`
+
+	// Language is "auto" to detect the spoken language, an ISO 639-1 code
+	// such as "fr", or empty for the model's default. Anything but English
+	// needs a multilingual model.
+	Language string `json:",omitempty"`
+
+	// Translate makes whisper emit English instead of the spoken language.
+	Translate bool `json:",omitempty"`
+
+	// WordTimestamps adds per-word timings and probabilities to every
+	// segment, taken from whisper's token timestamps.
+	WordTimestamps bool `json:",omitempty"`
+
+	// InitialPrompt is text whisper takes as coming before the audio, which
+	// steers spelling and style. Batch runs read PromptFile in VideoDir when
+	// it is empty and append the glossary terms.
+	InitialPrompt string `json:",omitempty"`
+
+	// Temperature is the sampling temperature of the first attempt; zero
+	// decodes greedily.
+	Temperature float32 `json:",omitempty"`
+
+	// TemperatureFallback is added to the temperature to retry a window
+	// whose output looks like a failure. Zero keeps whisper's 0.2, a
+	// negative value disables retries.
+	TemperatureFallback float32 `json:",omitempty"`
+
+	// EntropyThreshold marks a window as failed when its token entropy is
+	// below it, which catches repetition loops. Zero keeps whisper's 2.4.
+	EntropyThreshold float32 `json:",omitempty"`
+
+	// BeamSize decodes with beam search over this many candidates when it
+	// is above 1, which is slower but makes fewer mistakes. Zero or 1
+	// decodes greedily.
+	BeamSize uint `json:",omitempty"`
+
+	// BestOf is how many candidates are sampled when a window is retried
+	// at a higher temperature, keeping the most likely. Zero keeps
+	// whisper's 5.
+	BestOf uint `json:",omitempty"`
+
+	// MaxSegmentLength caps segments at about this many characters, which
+	// suits subtitles. Zero means no limit.
+	MaxSegmentLength uint `json:",omitempty"`
+
+	// SplitOnWord makes MaxSegmentLength break between words rather than
+	// tokens.
+	SplitOnWord bool `json:",omitempty"`
+
+	// MaxTokensPerSegment caps segments at this many tokens. Zero means no
+	// limit.
+	MaxTokensPerSegment uint `json:",omitempty"`
+
+	// Offset and Duration restrict decoding to a window of the audio;
+	// timestamps still count from the start of the audio. A zero Duration
+	// runs to the end. They apply to every Transcribe call, so batches
+	// refuse them together with VAD or chunking.
+	Offset   time.Duration `json:",omitempty"`
+	Duration time.Duration `json:",omitempty"`
+}
+
+// windowed reports whether only part of the audio is decoded.
+func (d DecodeOptions) windowed() bool {
+	return d.Offset > 0 || d.Duration > 0
+}
+
+// ParseDecodeOptions applies a comma separated list of key=value settings
+// to base, e.g. "temperature=0.2,max-len=42,split-on-word". A key alone
+// sets a boolean. Keys are threads, temperature, temperature-fallback,
+// entropy-threshold, beam-size, best-of, max-len, split-on-word,
+// max-tokens, offset, duration and words.
+func ParseDecodeOptions(spec string, base DecodeOptions) (DecodeOptions, error) {
+	d := base
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, hasValue := strings.Cut(item, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !hasValue {
+			value = "true"
+		}
+
+		var err error
+		switch key {
+		case "threads":
+			d.Threads, err = parseUint(value)
+		case "temperature":
+			d.Temperature, err = parseFloat32(value)
+		case "temperature-fallback":
+			d.TemperatureFallback, err = parseFloat32(value)
+		case "entropy-threshold":
+			d.EntropyThreshold, err = parseFloat32(value)
+		case "beam-size":
+			d.BeamSize, err = parseUint(value)
+		case "best-of":
+			d.BestOf, err = parseUint(value)
+		case "max-len":
+			d.MaxSegmentLength, err = parseUint(value)
+		case "split-on-word":
+			d.SplitOnWord, err = strconv.ParseBool(value)
+		case "max-tokens":
+			d.MaxTokensPerSegment, err = parseUint(value)
+		case "offset":
+			d.Offset, err = time.ParseDuration(value)
+		case "duration":
+			d.Duration, err = time.ParseDuration(value)
+		case "words":
+			d.WordTimestamps, err = strconv.ParseBool(value)
+		default:
+			return base, fmt.Errorf("unknown decode setting %q", key)
+		}
+		if err != nil {
+			return base, fmt.Errorf("invalid %s %q: %v", key, value, err)
+		}
+	}
+	if d.Offset < 0 || d.Duration < 0 {
+		return base, fmt.Errorf("offset and duration must not be negative")
+	}
+	return d, nil
+}
+
+func parseUint(s string) (uint, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	return uint(n), err
+}
+
+func parseFloat32(s string) (float32, error) {
+	f, err := strconv.ParseFloat(s, 32)
+	return float32(f), err
+}
+
+// LanguageAuto asks whisper to detect the spoken language.
+const LanguageAuto = "auto"
+
+// TranslationSuffix is inserted before the extension of translated outputs.
+const TranslationSuffix = ".en"
+
+// DefaultOptions returns the folder layout the service has always used with
+// a single worker that gets every CPU.
+func DefaultOptions() Options {
+	return Options{
+		VideoDir:  "Video",
+		AudioDir:  "audio",
+		OutputDir: "stt",
+		ModelPath: "models/ggml-base.en.bin",
+		Workers:   1,
+		VAD:       DefaultVADOptions(),
+		Chunk:     ChunkOptions{Overlap: 10 * time.Second, Parallel: 1},
+	}
+}
+
+// decodeThreads is the thread count of every session: all CPUs unless set.
+// Sessions take turns on the shared model, so each decode has the machine
+// to itself and splitting the CPUs across workers would only slow it down.
+func (o Options) decodeThreads() uint {
+	if o.Decode.Threads > 0 {
+		return o.Decode.Threads
+	}
+	return uint(runtime.NumCPU())
+}
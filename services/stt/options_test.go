@@ -0,0 +1,32 @@
+package stt
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDecodeOptions(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    DecodeOptions
+		wantErr bool
+	}{
+		{spec: "", want: DecodeOptions{}},
+		{spec: "beam-size=5, best-of=3", want: DecodeOptions{BeamSize: 5, BestOf: 3}},
+		{spec: "temperature=0.2,max-len=42,split-on-word", want: DecodeOptions{Temperature: 0.2, MaxSegmentLength: 42, SplitOnWord: true}},
+		{spec: "offset=1m,duration=30s,words", want: DecodeOptions{Offset: time.Minute, Duration: 30 * time.Second, WordTimestamps: true}},
+		{spec: "beam-size=-1", wantErr: true},
+		{spec: "offset=-1s", wantErr: true},
+		{spec: "patience=2", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseDecodeOptions(tt.spec, DecodeOptions{})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseDecodeOptions(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("ParseDecodeOptions(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
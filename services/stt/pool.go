@@ -0,0 +1,146 @@
+package stt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// FileError is the failure of a single file in a batch.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
+}
+
+// BatchResult collects the outcome of every file in a batch.
+type BatchResult struct {
+	Succeeded []string
+	Failed    []FileError
+}
+
+// Err joins every per-file failure, or returns nil when all files succeeded.
+func (r *BatchResult) Err() error {
+	errs := make([]error, len(r.Failed))
+	for i, f := range r.Failed {
+		errs[i] = f
+	}
+	return errors.Join(errs...)
+}
+
+// mediaJob is a file to process with what probing it found, so workers do
+// not probe it again. A nil info is probed by the worker.
+type mediaJob struct {
+	path string
+	info *MediaInfo
+}
+
+// runPool processes files with opts.Workers workers. Every worker opens its
+// own session on the shared transcriber, whose whisper context they take
+// turns on, so only their ffmpeg runs, file I/O and exports overlap.
+func runPool(ctx context.Context, files []mediaJob, b *batch) *BatchResult {
+	opts, logger := b.opts, b.logger
+	workers := opts.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(files) {
+		workers = len(files)
+	}
+	decode := opts.Decode
+	decode.Threads = opts.decodeThreads()
+	defer b.saveIndex()
+
+	jobs := make(chan mediaJob)
+	result := &BatchResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	record := func(path string, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			logger.Printf("Error processing %s: %v", path, err)
+			result.Failed = append(result.Failed, FileError{Path: path, Err: err})
+			return
+		}
+		result.Succeeded = append(result.Succeeded, path)
+	}
+
+	logger.Printf("Starting %d worker(s) with %d thread(s) each", workers, decode.Threads)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w, err := newWorker(b, decode)
+			if err != nil {
+				// Drain our share of the queue so the batch still finishes
+				for job := range jobs {
+					record(job.path, err)
+				}
+				return
+			}
+			for job := range jobs {
+				record(job.path, w.processWithTimeout(ctx, job.path, job.info))
+			}
+		}()
+	}
+
+	for i, job := range files {
+		select {
+		case jobs <- job:
+		case <-ctx.Done():
+			for _, rest := range files[i:] {
+				b.progress.finish(rest.path, StageFailed)
+				record(rest.path, ctx.Err())
+			}
+			close(jobs)
+			wg.Wait()
+			return result
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result
+}
+
+// newWorker opens the sessions a pool goroutine needs.
+func newWorker(b *batch, decode DecodeOptions) (*worker, error) {
+	// whisper otherwise assumes English, and an English transcript has
+	// nothing to translate
+	if b.opts.Translate && decode.Language == "" {
+		decode.Language = LanguageAuto
+	}
+	session, err := b.transcriber.NewSession(decode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+	w := &worker{batch: b, session: session}
+
+	if b.opts.Translate {
+		decode.Translate = true
+		if w.translator, err = b.transcriber.NewSession(decode); err != nil {
+			return nil, fmt.Errorf("failed to create translation session: %v", err)
+		}
+	}
+	return w, nil
+}
+
+// processWithTimeout runs one file under opts.FileTimeout, if set.
+func (w *worker) processWithTimeout(ctx context.Context, path string, info *MediaInfo) error {
+	if w.opts.FileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.opts.FileTimeout)
+		defer cancel()
+	}
+	return w.process(ctx, path, info)
+}
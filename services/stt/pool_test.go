@@ -0,0 +1,143 @@
+package stt
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"sts/internal/models"
+)
+
+// fakeTranscriber stands in for whisper. Its sessions "hear" French, but
+// like whisper they decode English when no language is requested.
+type fakeTranscriber struct {
+	sessions []DecodeOptions
+}
+
+func (f *fakeTranscriber) NewSession(opts DecodeOptions) (Session, error) {
+	f.sessions = append(f.sessions, opts)
+	return fakeSession{opts}, nil
+}
+
+func (f *fakeTranscriber) Close() error { return nil }
+
+type fakeSession struct {
+	opts DecodeOptions
+}
+
+func (s fakeSession) Transcribe(ctx context.Context, samples []float32) (*models.Transcript, error) {
+	language, text := "fr", "bonjour"
+	if s.opts.Language == "" {
+		language, text = "en", "bone sure"
+	}
+	if s.opts.Translate {
+		text = "hello"
+	}
+	end := samplesToDuration(len(samples))
+	return &models.Transcript{
+		Language: language,
+		Segments: []models.SegmentResult{{Start: 0, End: end, Text: text}},
+	}, nil
+}
+
+// writeTestWav writes 16-bit mono PCM samples as a WAV file.
+func writeTestWav(t *testing.T, path string, rate int, samples []int16) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	size := uint32(2 * len(samples))
+	le := binary.LittleEndian
+	header := []any{
+		[]byte("RIFF"), 36 + size, []byte("WAVE"),
+		[]byte("fmt "), uint32(16), uint16(wavFormatPCM), uint16(1), uint32(rate), uint32(2 * rate), uint16(2), uint16(16),
+		[]byte("data"), size,
+	}
+	for _, v := range header {
+		if err := binary.Write(f, le, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := binary.Write(f, le, samples); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTranslateWithoutLanguageDetects(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.VideoDir = filepath.Join(dir, "Video")
+	opts.AudioDir = filepath.Join(dir, "audio")
+	opts.OutputDir = filepath.Join(dir, "stt")
+	opts.Translate = true
+	for _, d := range []string{opts.VideoDir, opts.AudioDir, opts.OutputDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := filepath.Join(opts.VideoDir, "clip.wav")
+	writeTestWav(t, source, SampleRate, make([]int16, SampleRate))
+
+	manifest, err := LoadManifest(filepath.Join(opts.OutputDir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcriber := &fakeTranscriber{}
+	b := &batch{opts: opts, transcriber: transcriber, manifest: manifest, logger: log.New(io.Discard, "", 0)}
+	w, err := newWorker(b, opts.Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range transcriber.sessions {
+		if s.Language != LanguageAuto {
+			t.Errorf("session %+v does not detect the language", s)
+		}
+	}
+
+	if _, err := w.processFile(context.Background(), source, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(opts.OutputDir, "clip.wav"+TranslationSuffix+".json"))
+	if err != nil {
+		t.Fatalf("no translation written: %v", err)
+	}
+	translation, err := models.DecodeTranscript(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !translation.Translated || translation.Language != "fr" || translation.Segments[0].Text != "hello" {
+		t.Errorf("translation = %+v", translation)
+	}
+}
+
+func TestProcessFileUsesScannedInfo(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.AudioDir = dir
+	opts.OutputDir = dir
+	source := filepath.Join(dir, "clip.wav")
+	writeTestWav(t, source, SampleRate, make([]int16, SampleRate))
+	manifest, err := LoadManifest(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &batch{opts: opts, transcriber: &fakeTranscriber{}, manifest: manifest, logger: log.New(io.Discard, "", 0)}
+	w, err := newWorker(b, opts.Decode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The scan's info is trusted rather than probing the file again
+	if _, err := w.processFile(context.Background(), source, &MediaInfo{Format: "wav"}); err == nil {
+		t.Error("file the scan found no audio in was processed")
+	}
+	if _, err := w.processFile(context.Background(), source, nil); err != nil {
+		t.Errorf("probing the file itself: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package stt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// MediaInfo is what ffprobe reports about an input file.
+type MediaInfo struct {
+	HasAudio bool
+	HasVideo bool
+	Duration time.Duration
+
+	// Format is the container, e.g. "wav" or "mov,mp4,m4a,3gp,3g2,mj2"
+	Format string
+
+	// Format of the first audio stream
+	AudioCodec string
+	SampleRate int
+	Channels   int
+}
+
+// IsWav reports whether the file is a WAV the built-in decoder reads, so it
+// needs no ffmpeg whatever its rate and channels.
+func (m *MediaInfo) IsWav() bool {
+	return m.Format == "wav" && !m.HasVideo && wavCodecs[m.AudioCodec]
+}
+
+var wavCodecs = map[string]bool{
+	"pcm_u8": true, "pcm_s16le": true, "pcm_s24le": true, "pcm_s32le": true,
+	"pcm_f32le": true, "pcm_f64le": true,
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType   string `json:"codec_type"`
+		CodecName   string `json:"codec_name"`
+		SampleRate  string `json:"sample_rate"`
+		Channels    int    `json:"channels"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+	} `json:"format"`
+}
+
+// ProbeMedia asks ffprobe which streams path has. Files ffprobe cannot read
+// return an error; readable files without audio return HasAudio false.
+// Without ffprobe installed only WAV files are recognized, from their header.
+func ProbeMedia(ctx context.Context, path string) (*MediaInfo, error) {
+	cmd := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "stream=codec_type,codec_name,sample_rate,channels:stream_disposition=attached_pic:format=format_name,duration",
+		"-of", "json",
+		path,
+	)
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		if info, wavErr := probeWav(path); wavErr == nil {
+			return info, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %v", err)
+	}
+
+	info := &MediaInfo{Format: probe.Format.FormatName}
+	for _, stream := range probe.Streams {
+		switch stream.CodecType {
+		case "audio":
+			if !info.HasAudio {
+				info.HasAudio = true
+				info.AudioCodec = stream.CodecName
+				info.SampleRate, _ = strconv.Atoi(stream.SampleRate)
+				info.Channels = stream.Channels
+			}
+		case "video":
+			// Cover art of audio files shows up as a one-frame video stream
+			if stream.Disposition.AttachedPic == 0 {
+				info.HasVideo = true
+			}
+		}
+	}
+	if seconds, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+	return info, nil
+}
@@ -0,0 +1,236 @@
+package stt
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Stage is the step of the pipeline a file is in.
+type Stage string
+
+const (
+	StageDecoding     Stage = "decoding"
+	StageTranscribing Stage = "transcribing"
+	StageDone         Stage = "done"
+	StageSkipped      Stage = "skipped"
+	StageFailed       Stage = "failed"
+)
+
+// Share of a file's progress spent in each stage. Decoding is usually a
+// small fraction of the whisper time.
+const decodeShare = 0.1
+
+// ProgressEvent reports where one file and the whole batch are.
+type ProgressEvent struct {
+	File  string
+	Stage Stage
+
+	// Percent of this file, 0-100
+	Percent float64
+
+	// Elapsed is the wall time spent on this file so far.
+	Elapsed time.Duration
+
+	// RealTimeFactor is processing time over audio time; below 1 is faster
+	// than real time. Zero until it can be estimated.
+	RealTimeFactor float64
+
+	// ETA is the estimated time left for this file, zero if unknown.
+	ETA time.Duration
+
+	Batch BatchProgress
+}
+
+// BatchProgress reports the whole batch, weighted by audio duration.
+type BatchProgress struct {
+	Files    int
+	Finished int
+	Percent  float64
+	Elapsed  time.Duration
+	ETA      time.Duration
+}
+
+// ProgressFunc receives progress events. Calls are serialized even when
+// several workers run, so it needs no locking of its own.
+type ProgressFunc func(ProgressEvent)
+
+// progressTracker turns stage updates from the workers into events. A nil
+// tracker ignores every call.
+type progressTracker struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	start time.Time
+
+	durations map[string]time.Duration // probed audio length of every file
+	total     time.Duration
+	done      time.Duration // audio of finished files
+	finished  int
+	active    map[string]*fileProgress
+}
+
+type fileProgress struct {
+	start    time.Time
+	stage    Stage
+	fraction float64
+	percent  int // last reported whole percent, to skip duplicate events
+}
+
+func newProgressTracker(fn ProgressFunc, durations map[string]time.Duration) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	t := &progressTracker{
+		fn:        fn,
+		start:     time.Now(),
+		durations: durations,
+		active:    map[string]*fileProgress{},
+	}
+	for _, d := range durations {
+		t.total += d
+	}
+	return t
+}
+
+// add makes file part of the batch. Files listed up front are passed to
+// newProgressTracker; watch mode adds them as they arrive.
+func (t *progressTracker) add(file string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.total += duration - t.durations[file]
+	t.durations[file] = duration
+}
+
+// begin marks file as started.
+func (t *progressTracker) begin(file string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active[file] = &fileProgress{start: time.Now(), stage: StageDecoding, percent: -1}
+	t.emit(file)
+}
+
+// update reports fraction (0-1) of stage done for file.
+func (t *progressTracker) update(file string, stage Stage, fraction float64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fp, ok := t.active[file]
+	if !ok {
+		return
+	}
+	fraction = min(max(fraction, 0), 1)
+	switch stage {
+	case StageDecoding:
+		fraction *= decodeShare
+	case StageTranscribing:
+		fraction = decodeShare + fraction*(1-decodeShare)
+	}
+	stageChanged := fp.stage != stage
+	fp.stage = stage
+	fp.fraction = max(fp.fraction, fraction)
+	if !stageChanged && int(fp.fraction*100) == fp.percent {
+		return
+	}
+	t.emit(file)
+}
+
+// finish marks file as done, skipped or failed.
+func (t *progressTracker) finish(file string, stage Stage) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fp, ok := t.active[file]
+	if !ok {
+		fp = &fileProgress{start: time.Now()}
+		t.active[file] = fp
+	}
+	fp.stage = stage
+	fp.fraction = 1
+	t.emit(file)
+	delete(t.active, file)
+	t.done += t.durations[file]
+	t.finished++
+}
+
+// progressFunc returns a callback reporting stage progress of file, or nil
+// for a nil tracker.
+func (t *progressTracker) progressFunc(file string, stage Stage) func(float64) {
+	if t == nil {
+		return nil
+	}
+	return func(fraction float64) { t.update(file, stage, fraction) }
+}
+
+// emit sends the event for file; t.mu must be held.
+func (t *progressTracker) emit(file string) {
+	fp := t.active[file]
+	fp.percent = int(fp.fraction * 100)
+	now := time.Now()
+
+	event := ProgressEvent{
+		File:    file,
+		Stage:   fp.stage,
+		Percent: fp.fraction * 100,
+		Elapsed: now.Sub(fp.start),
+	}
+	if fp.stage == StageDone || fp.stage == StageSkipped || fp.stage == StageFailed {
+		event.Percent = 100
+	}
+	if audio := t.durations[file]; audio > 0 && fp.fraction > 0 {
+		event.RealTimeFactor = event.Elapsed.Seconds() / (audio.Seconds() * fp.fraction)
+	}
+	event.ETA = eta(event.Elapsed, fp.fraction)
+
+	// Batch progress counts finished files fully and active ones partially
+	covered := t.done
+	for name, active := range t.active {
+		covered += time.Duration(float64(t.durations[name]) * active.fraction)
+	}
+	event.Batch = BatchProgress{
+		Files:    len(t.durations),
+		Finished: t.finished,
+		Elapsed:  now.Sub(t.start),
+	}
+	if t.total > 0 {
+		fraction := float64(covered) / float64(t.total)
+		event.Batch.Percent = fraction * 100
+		event.Batch.ETA = eta(event.Batch.Elapsed, fraction)
+	}
+
+	t.fn(event)
+}
+
+// eta extrapolates the time left from the time spent on fraction of the work.
+func eta(elapsed time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || fraction >= 1 {
+		return 0
+	}
+	return time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+}
+
+type progressKey struct{}
+
+// withProgress attaches a whisper progress callback to ctx. Sessions report
+// through it without every Transcribe call growing another parameter.
+func withProgress(ctx context.Context, fn func(float64)) context.Context {
+	if fn == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFrom returns the callback attached by withProgress, if any.
+func progressFrom(ctx context.Context) func(float64) {
+	fn, _ := ctx.Value(progressKey{}).(func(float64))
+	return fn
+}
@@ -0,0 +1,121 @@
+package stt
+
+import "math"
+
+// Windowed-sinc resampler settings. 16 zero crossings with a Kaiser window
+// of beta 8.6 keep aliasing below about -80 dB, far under what whisper can
+// hear, at a cost that is small next to transcription.
+const (
+	resampleZeroCrossings = 16
+	resampleBeta          = 8.6
+	resampleRolloff       = 0.95 // cutoff as a fraction of the lower Nyquist
+
+	// Largest polyphase table built; odd rate pairs need one phase per
+	// output position and compute their taps on the fly instead.
+	resampleMaxTable = 1 << 22
+)
+
+// resample converts samples from rate from to rate to with a band-limited
+// windowed-sinc interpolator. Downsampling low-passes at the new Nyquist
+// first, so nothing above 8 kHz folds into the speech band at 16 kHz.
+func resample(samples []float32, from, to int) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+
+	// Output position n sits at n*step/up input samples, with up phases
+	// between two input samples
+	g := gcd(from, to)
+	up, step := to/g, from/g
+
+	cutoff := resampleRolloff * math.Min(1, float64(to)/float64(from))
+	half := int(math.Ceil(resampleZeroCrossings / cutoff))
+	taps := 2 * half
+
+	kernel := func(x float64) float64 {
+		// x is in input samples from the output position
+		if x <= -float64(half) || x >= float64(half) {
+			return 0
+		}
+		w := kaiser(x/float64(half), resampleBeta)
+		return cutoff * sinc(cutoff*x) * w
+	}
+
+	var table []float32
+	if up*taps <= resampleMaxTable {
+		table = make([]float32, up*taps)
+		for phase := 0; phase < up; phase++ {
+			frac := float64(phase) / float64(up)
+			for k := 0; k < taps; k++ {
+				table[phase*taps+k] = float32(kernel(float64(k-half+1) - frac))
+			}
+		}
+	}
+
+	n := int(int64(len(samples)) * int64(to) / int64(from))
+	out := make([]float32, n)
+	for i := range out {
+		pos := int64(i) * int64(step)
+		base := int(pos / int64(up))
+		phase := int(pos % int64(up))
+		first := base - half + 1
+
+		var sum float64
+		if table != nil {
+			coeffs := table[phase*taps : (phase+1)*taps]
+			if first >= 0 && first+taps <= len(samples) {
+				for k, c := range coeffs {
+					sum += float64(c * samples[first+k])
+				}
+			} else {
+				for k, c := range coeffs {
+					if j := first + k; j >= 0 && j < len(samples) {
+						sum += float64(c * samples[j])
+					}
+				}
+			}
+		} else {
+			frac := float64(phase) / float64(up)
+			for k := 0; k < taps; k++ {
+				if j := first + k; j >= 0 && j < len(samples) {
+					sum += kernel(float64(k-half+1)-frac) * float64(samples[j])
+				}
+			}
+		}
+		out[i] = float32(sum)
+	}
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// kaiser is the Kaiser window at x in [-1, 1].
+func kaiser(x, beta float64) float64 {
+	return besselI0(beta*math.Sqrt(1-x*x)) / besselI0(beta)
+}
+
+// besselI0 is the modified Bessel function of the first kind, order zero,
+// from its power series.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; k < 50; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,56 @@
+package stt
+
+import (
+	"math"
+	"testing"
+)
+
+// toneLevel resamples one second of a sine at freq Hz to 16 kHz and returns
+// its RMS relative to a full-scale sine, away from the edges.
+func toneLevel(from int, freq float64) float64 {
+	in := make([]float32, from)
+	for i := range in {
+		in[i] = float32(math.Sin(2 * math.Pi * freq * float64(i) / float64(from)))
+	}
+	out := resample(in, from, SampleRate)
+	middle := out[len(out)/4 : 3*len(out)/4]
+	var sum float64
+	for _, s := range middle {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum/float64(len(middle))) * math.Sqrt2
+}
+
+func TestResample(t *testing.T) {
+	tests := []struct {
+		name string
+		from int
+		freq float64
+		min  float64
+		max  float64
+	}{
+		// Speech frequencies pass unchanged
+		{"passband 44.1k", 44100, 1000, 0.999, 1.001},
+		{"passband 48k", 48000, 3000, 0.999, 1.001},
+		{"passband 8k", 8000, 1000, 0.999, 1.001},
+		{"passband edge", 48000, 6000, 0.999, 1.001},
+		// Tones above the new Nyquist are removed rather than folded down
+		{"stopband 44.1k", 44100, 12000, 0, 1e-3},
+		{"stopband 48k", 48000, 9000, 0, 1e-3},
+		{"stopband 22.05k", 22050, 10000, 0, 1e-3},
+	}
+	for _, tt := range tests {
+		if level := toneLevel(tt.from, tt.freq); level < tt.min || level > tt.max {
+			t.Errorf("%s: %.0f Hz from %d Hz has level %.5f, want %g to %g", tt.name, tt.freq, tt.from, level, tt.min, tt.max)
+		}
+	}
+}
+
+func TestResampleLength(t *testing.T) {
+	for _, from := range []int{8000, 16000, 22050, 44100, 48000} {
+		in := make([]float32, 3*from)
+		if got := len(resample(in, from, SampleRate)); got != 3*SampleRate {
+			t.Errorf("%d Hz: %d samples, want %d", from, got, 3*SampleRate)
+		}
+	}
+}
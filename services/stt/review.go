@@ -0,0 +1,93 @@
+package stt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"sts/internal/models"
+)
+
+// ReviewSuffix is inserted before the extension of review reports,
+// e.g. clip.mp4.review.txt.
+const ReviewSuffix = ".review"
+
+// reviewGap is the longest pause between two flagged segments that still
+// puts them in one range, so editors get fewer and longer ranges to check.
+const reviewGap = 2 * time.Second
+
+// ReviewRange is a stretch of flagged segments.
+type ReviewRange struct {
+	Start, End time.Duration
+
+	// Lowest is the smallest MinProbability of the range's segments
+	Lowest   float32
+	Segments []models.SegmentResult
+}
+
+// FlagForReview sets Review on every segment whose average token probability
+// is below threshold and returns the number flagged. Segments without text
+// tokens are left alone.
+func FlagForReview(segments []models.SegmentResult, threshold float32) int {
+	flagged := 0
+	for i := range segments {
+		seg := &segments[i]
+		seg.Review = seg.AvgProbability > 0 && seg.AvgProbability < threshold
+		if seg.Review {
+			flagged++
+		}
+	}
+	return flagged
+}
+
+// ReviewRanges groups the flagged segments into time ranges.
+func ReviewRanges(segments []models.SegmentResult) []ReviewRange {
+	var ranges []ReviewRange
+	for _, seg := range segments {
+		if !seg.Review {
+			continue
+		}
+		if n := len(ranges); n > 0 && seg.Start-ranges[n-1].End <= reviewGap {
+			last := &ranges[n-1]
+			last.End = max(last.End, seg.End)
+			last.Lowest = min(last.Lowest, seg.MinProbability)
+			last.Segments = append(last.Segments, seg)
+			continue
+		}
+		ranges = append(ranges, ReviewRange{
+			Start:    seg.Start,
+			End:      seg.End,
+			Lowest:   seg.MinProbability,
+			Segments: []models.SegmentResult{seg},
+		})
+	}
+	return ranges
+}
+
+// writeReview writes the review report of source to path, listing every
+// range with the text of its segments.
+func writeReview(path, source string, threshold float32, ranges []ReviewRange) error {
+	var buf bytes.Buffer
+	var total time.Duration
+	for _, r := range ranges {
+		total += r.End - r.Start
+	}
+	fmt.Fprintf(&buf, "Review: %s\n", source)
+	fmt.Fprintf(&buf, "%d range(s), %s to check, segments below %.2f average token probability\n",
+		len(ranges), total.Round(time.Second), threshold)
+
+	for _, r := range ranges {
+		fmt.Fprintf(&buf, "\n%s - %s  (lowest token %.2f)\n", reviewClock(r.Start), reviewClock(r.End), r.Lowest)
+		for _, seg := range r.Segments {
+			fmt.Fprintf(&buf, "  [%.2f] %s\n", seg.AvgProbability, strings.TrimSpace(seg.Text))
+		}
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// reviewClock formats d as H:MM:SS, which is what video players seek to.
+func reviewClock(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
@@ -0,0 +1,18 @@
+package stt
+
+import (
+	"unsafe"
+
+	whispercpp "github.com/ggerganov/whisper.cpp/bindings/go"
+)
+
+/*
+#include <whisper.h>
+*/
+import "C"
+
+// setBestOf sets how many candidates are sampled at a non-zero temperature.
+// The bindings have no setter for it, but their Params is the C struct.
+func setBestOf(params *whispercpp.Params, n int) {
+	(*C.struct_whisper_full_params)(unsafe.Pointer(params)).greedy.best_of = C.int(n)
+}
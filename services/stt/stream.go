@@ -0,0 +1,263 @@
+package stt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"sts/internal/models"
+)
+
+// PCMEncoding is the sample format of a raw PCM stream, named like ffmpeg's
+// -f option that produces it.
+type PCMEncoding string
+
+const (
+	PCMS16LE PCMEncoding = "s16le"
+	PCMF32LE PCMEncoding = "f32le"
+)
+
+// StreamOptions configures a StreamTranscriber.
+type StreamOptions struct {
+	// Encoding of the 16 kHz mono samples read from the stream.
+	Encoding PCMEncoding
+
+	// Window is the most audio transcribed in one pass. whisper looks at 30s
+	// at a time, so longer windows only add work.
+	Window time.Duration
+
+	// Step is how much new audio triggers the next pass, and so how often
+	// partial segments are updated.
+	Step time.Duration
+}
+
+// DefaultStreamOptions reads s16le, as `ffmpeg -f s16le -ar 16000 -ac 1`
+// writes it, and updates every 3s.
+func DefaultStreamOptions() StreamOptions {
+	return StreamOptions{
+		Encoding: PCMS16LE,
+		Window:   30 * time.Second,
+		Step:     3 * time.Second,
+	}
+}
+
+// StreamSegment is a segment of a live transcript. Times are relative to
+// the start of the stream.
+type StreamSegment struct {
+	Segment models.SegmentResult
+
+	// Final segments never change. A partial segment is replaced by the
+	// segments of the next pass, so a caption display shows every final
+	// segment plus only the latest partial ones.
+	Final bool
+}
+
+// StreamTranscriber transcribes PCM audio while it arrives, using a sliding
+// window over the audio not yet finalized.
+//
+// Every Step of new audio the window is transcribed again. All segments but
+// the last are then final and their audio is dropped from the window; the
+// last one is partial since its words may still be cut off. When the window
+// reaches Window every segment in it is finalized.
+type StreamTranscriber struct {
+	session Session
+	opts    StreamOptions
+}
+
+// NewStreamTranscriber returns a StreamTranscriber decoding with session.
+// Zero option fields take their defaults.
+func NewStreamTranscriber(session Session, opts StreamOptions) (*StreamTranscriber, error) {
+	defaults := DefaultStreamOptions()
+	if opts.Encoding == "" {
+		opts.Encoding = defaults.Encoding
+	}
+	if opts.Encoding != PCMS16LE && opts.Encoding != PCMF32LE {
+		return nil, fmt.Errorf("unsupported PCM encoding %q", opts.Encoding)
+	}
+	if opts.Window <= 0 {
+		opts.Window = defaults.Window
+	}
+	if opts.Step <= 0 {
+		opts.Step = defaults.Step
+	}
+	if opts.Step > opts.Window {
+		return nil, fmt.Errorf("stream step %s is longer than the window %s", opts.Step, opts.Window)
+	}
+	return &StreamTranscriber{session: session, opts: opts}, nil
+}
+
+// minPass is the shortest audio handed to whisper, which rejects anything
+// under a second. Shorter windows are padded with silence.
+const minPass = SampleRate
+
+// Run reads r until EOF and sends the segments to out, closing it when done.
+// The remaining audio is finalized at EOF. Cancelling ctx stops Run, but a
+// Read blocked on r only returns once r is closed.
+func (s *StreamTranscriber) Run(ctx context.Context, r io.Reader, out chan<- StreamSegment) error {
+	defer close(out)
+
+	chunks := make(chan []float32, 64)
+	readDone := make(chan error, 1)
+	go func() {
+		readDone <- readPCM(ctx, r, s.opts.Encoding, chunks)
+	}()
+
+	step := durationToSamples(s.opts.Step)
+	var pending []float32 // audio since the last final segment
+	var base int          // stream offset of pending[0]
+	var fresh int         // samples received since the last pass
+	eof := false
+
+	for !eof {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case chunk, ok := <-chunks:
+			if !ok {
+				eof = true
+				break
+			}
+			pending = append(pending, chunk...)
+			fresh += len(chunk)
+		}
+		if !eof && fresh < step {
+			continue
+		}
+
+		// Catch up with everything that arrived during the last pass
+	drain:
+		for !eof {
+			select {
+			case chunk, ok := <-chunks:
+				if !ok {
+					eof = true
+					break drain
+				}
+				pending = append(pending, chunk...)
+			default:
+				break drain
+			}
+		}
+		fresh = 0
+
+		// A pass can finalize only part of the window, so repeat until the
+		// rest fits or, at EOF, nothing is left
+		for len(pending) > 0 {
+			cut, err := s.pass(ctx, pending, base, eof, out)
+			if err != nil {
+				return err
+			}
+			pending = pending[cut:]
+			base += cut
+			if cut == 0 || !eof && len(pending) <= durationToSamples(s.opts.Window) {
+				break
+			}
+		}
+	}
+
+	if err := <-readDone; err != nil {
+		return fmt.Errorf("failed to read audio stream: %v", err)
+	}
+	return nil
+}
+
+// pass transcribes the start of pending, sends its segments and returns how
+// many samples were finalized.
+func (s *StreamTranscriber) pass(ctx context.Context, pending []float32, base int, final bool, out chan<- StreamSegment) (int, error) {
+	if len(pending) == 0 {
+		return 0, nil
+	}
+	window := pending
+	if limit := durationToSamples(s.opts.Window); len(window) > limit {
+		window = window[:limit]
+		final = true
+	}
+	input := window
+	if len(input) < minPass {
+		input = make([]float32, minPass)
+		copy(input, window)
+	}
+
+	transcript, err := s.session.Transcribe(ctx, input)
+	if err != nil {
+		return 0, err
+	}
+	segments := transcript.Segments
+
+	finished := len(segments) - 1
+	if final {
+		finished = len(segments)
+	}
+	finished = max(finished, 0)
+
+	offset := samplesToDuration(base)
+	for i, seg := range segments {
+		seg.Start += offset
+		seg.End += offset
+		for j := range seg.Words {
+			seg.Words[j].Start += offset
+			seg.Words[j].End += offset
+		}
+		select {
+		case out <- StreamSegment{Segment: seg, Final: i < finished}:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	// Drop the audio of the final segments. A final pass drops the whole
+	// window, silence included, so it cannot grow without bound.
+	if final {
+		return len(window), nil
+	}
+	if finished == 0 {
+		return 0, nil
+	}
+	return min(durationToSamples(segments[finished-1].End), len(window)), nil
+}
+
+// readPCM decodes samples from r into chunks until EOF and closes chunks.
+func readPCM(ctx context.Context, r io.Reader, encoding PCMEncoding, chunks chan<- []float32) error {
+	defer close(chunks)
+
+	size := 2
+	if encoding == PCMF32LE {
+		size = 4
+	}
+	br := bufio.NewReaderSize(r, 32*1024)
+	buf := make([]byte, 32*1024)
+	var carry int
+	for {
+		n, err := br.Read(buf[carry:])
+		n += carry
+		whole := n - n%size
+		if whole > 0 {
+			chunk := make([]float32, whole/size)
+			for i := range chunk {
+				b := buf[i*size:]
+				if encoding == PCMF32LE {
+					chunk[i] = math.Float32frombits(binary.LittleEndian.Uint32(b))
+				} else {
+					chunk[i] = float32(int16(binary.LittleEndian.Uint16(b))) / 32768
+				}
+			}
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		carry = copy(buf, buf[whole:n])
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package stt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"sts/internal/models"
+)
+
+// secondsSession hears one segment per second of audio. The audio of second
+// k of the stream has the value (k+1)/64, which becomes the segment's text,
+// so every segment tells which part of the stream it was made from. Silence
+// padding ends the transcript.
+type secondsSession struct {
+	inputs []int
+}
+
+func (s *secondsSession) Transcribe(ctx context.Context, samples []float32) (*models.Transcript, error) {
+	s.inputs = append(s.inputs, len(samples))
+	transcript := &models.Transcript{Language: "en"}
+	for start := 0; start < len(samples) && samples[start] != 0; start += SampleRate {
+		end := start
+		for end < min(start+SampleRate, len(samples)) && samples[end] != 0 {
+			end++
+		}
+		k := int(math.Round(float64(samples[start])*64)) - 1
+		transcript.Segments = append(transcript.Segments, models.SegmentResult{
+			Start: samplesToDuration(start),
+			End:   samplesToDuration(end),
+			Text:  strconv.Itoa(k),
+		})
+	}
+	return transcript, nil
+}
+
+// countingPCM returns seconds of s16le audio in the layout secondsSession
+// expects, followed by a partial second.
+func countingPCM(seconds int, extra time.Duration) []byte {
+	var buf bytes.Buffer
+	total := seconds*SampleRate + durationToSamples(extra)
+	for i := 0; i < total; i++ {
+		v := int16((i/SampleRate + 1) * 512)
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+// runStream runs a StreamTranscriber over r and returns the segments it
+// sent in order.
+func runStream(t *testing.T, session Session, opts StreamOptions, r io.Reader) []StreamSegment {
+	t.Helper()
+	st, err := NewStreamTranscriber(session, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan StreamSegment)
+	done := make(chan error, 1)
+	go func() { done <- st.Run(context.Background(), r, out) }()
+	var segments []StreamSegment
+	for seg := range out {
+		segments = append(segments, seg)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return segments
+}
+
+// checkFinals verifies that the final segments cover seconds 0 to n-1 of the
+// stream once each, in order, and at the right times.
+func checkFinals(t *testing.T, segments []StreamSegment, n int, end time.Duration) {
+	t.Helper()
+	var finals []models.SegmentResult
+	for _, s := range segments {
+		if s.Final {
+			finals = append(finals, s.Segment)
+		}
+	}
+	if len(finals) != n {
+		t.Fatalf("%d final segments, want %d: %+v", len(finals), n, finals)
+	}
+	for k, seg := range finals {
+		wantEnd := min(time.Duration(k+1)*time.Second, end)
+		if seg.Text != strconv.Itoa(k) || seg.Start != time.Duration(k)*time.Second || seg.End != wantEnd {
+			t.Errorf("final segment %d = %q at %s-%s", k, seg.Text, seg.Start, seg.End)
+		}
+	}
+}
+
+func TestStreamWindowAdvances(t *testing.T) {
+	session := &secondsSession{}
+	opts := StreamOptions{Window: 4 * time.Second, Step: time.Second}
+	segments := runStream(t, session, opts, bytes.NewReader(countingPCM(10, 0)))
+
+	checkFinals(t, segments, 10, 10*time.Second)
+	for _, n := range session.inputs {
+		if n > durationToSamples(opts.Window) || n < minPass {
+			t.Errorf("pass over %d samples, window is %d", n, durationToSamples(opts.Window))
+		}
+	}
+}
+
+// slowReader hands out its data in small reads with a pause between them,
+// the way a live stream arrives.
+type slowReader struct {
+	data []byte
+	size int
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	time.Sleep(time.Millisecond)
+	n := copy(p[:min(len(p), r.size)], r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestStreamPartialsAreReplaced(t *testing.T) {
+	session := &secondsSession{}
+	opts := StreamOptions{Window: 3 * time.Second, Step: 500 * time.Millisecond}
+	// Odd read sizes split samples across reads
+	data := countingPCM(7, 250*time.Millisecond)
+	segments := runStream(t, session, opts, &slowReader{data: data, size: 4001})
+
+	checkFinals(t, segments, 8, 7250*time.Millisecond)
+
+	// A partial segment only ever previews a second that is not final yet
+	finalized := -1
+	for _, s := range segments {
+		k, _ := strconv.Atoi(s.Segment.Text)
+		if k <= finalized {
+			t.Fatalf("segment %q sent after it was final", s.Segment.Text)
+		}
+		if s.Final {
+			finalized = k
+		}
+	}
+	if len(segments) == 8 {
+		t.Error("no partial segments sent while the stream arrived")
+	}
+}
+
+func TestStreamReadsF32(t *testing.T) {
+	var buf bytes.Buffer
+	for i := 0; i < 2*SampleRate+100; i++ {
+		binary.Write(&buf, binary.LittleEndian, float32(i/SampleRate+1)/64)
+	}
+	segments := runStream(t, &secondsSession{}, StreamOptions{Encoding: PCMF32LE}, iotest.HalfReader(&buf))
+	checkFinals(t, segments, 3, samplesToDuration(2*SampleRate+100))
+}
+
+type failingSession struct{ err error }
+
+func (s failingSession) Transcribe(ctx context.Context, samples []float32) (*models.Transcript, error) {
+	return nil, s.err
+}
+
+func TestStreamErrors(t *testing.T) {
+	if _, err := NewStreamTranscriber(&secondsSession{}, StreamOptions{Encoding: "mp3"}); err == nil {
+		t.Error("mp3 stream accepted")
+	}
+	if _, err := NewStreamTranscriber(&secondsSession{}, StreamOptions{Window: time.Second, Step: 2 * time.Second}); err == nil {
+		t.Error("step longer than the window accepted")
+	}
+
+	errDecode := errors.New("decode failed")
+	st, err := NewStreamTranscriber(failingSession{errDecode}, StreamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan StreamSegment, 16)
+	if err := st.Run(context.Background(), bytes.NewReader(countingPCM(1, 0)), out); !errors.Is(err, errDecode) {
+		t.Errorf("Run error = %v, want %v", err, errDecode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, w := io.Pipe()
+	defer w.Close()
+	if err := st.Run(ctx, r, make(chan StreamSegment)); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Run error = %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package stt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	whispercpp "github.com/ggerganov/whisper.cpp/bindings/go"
+	"github.com/ggerganov/whisper.cpp/bindings/go/pkg/whisper"
+
+	"sts/internal/models"
+)
+
+// Transcriber is a speech-to-text engine that keeps its model loaded for its
+// whole lifetime and hands out sessions for individual jobs.
+type Transcriber interface {
+	// NewSession returns a decoding session backed by the loaded model.
+	// Sessions may be used from different goroutines, but their Transcribe
+	// calls on one model are serialized.
+	NewSession(opts DecodeOptions) (Session, error)
+
+	io.Closer
+}
+
+// Session transcribes 16 kHz mono samples into timed segments.
+type Session interface {
+	// Transcribe returns ctx.Err() if ctx is done before decoding finishes.
+	Transcribe(ctx context.Context, samples []float32) (*models.Transcript, error)
+}
+
+// WhisperTranscriber is a Transcriber backed by a whisper.cpp model.
+//
+// whisper.cpp keeps a single decoder state and callback table per model,
+// so concurrent sessions take turns inside whisper itself. Audio extraction,
+// decoding and output writing of other workers still overlap with it.
+//
+// It drives the low-level bindings rather than pkg/whisper, whose contexts
+// are always greedy, so that sessions can pick beam search.
+type WhisperTranscriber struct {
+	ctx       *whispercpp.Context
+	modelPath string
+
+	// turn is a one-slot semaphore rather than a mutex so that waiting for
+	// the model can be cancelled
+	turn chan struct{}
+}
+
+// Make sure WhisperTranscriber adheres to the interface
+var _ Transcriber = (*WhisperTranscriber)(nil)
+
+// NewWhisperTranscriber loads the ggml model at modelPath once.
+func NewWhisperTranscriber(modelPath string) (*WhisperTranscriber, error) {
+	if _, err := os.Stat(modelPath); err != nil {
+		return nil, fmt.Errorf("failed to load model: %v", err)
+	}
+	ctx := whispercpp.Whisper_init(modelPath)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load model: %w", whisper.ErrUnableToLoadModel)
+	}
+	return &WhisperTranscriber{ctx: ctx, modelPath: modelPath, turn: make(chan struct{}, 1)}, nil
+}
+
+// ModelPath returns the path the model was loaded from.
+func (t *WhisperTranscriber) ModelPath() string {
+	return t.modelPath
+}
+
+func (t *WhisperTranscriber) multilingual() bool {
+	return t.ctx.Whisper_is_multilingual() != 0
+}
+
+// NewSession returns a session that decodes with the shared model. It fails
+// early when a non-English language is requested from an English-only model.
+func (t *WhisperTranscriber) NewSession(opts DecodeOptions) (Session, error) {
+	lang := strings.ToLower(opts.Language)
+	if !t.multilingual() && lang != "" && lang != LanguageAuto && lang != "en" {
+		return nil, fmt.Errorf("language %q needs a multilingual model, %s is English-only: %w",
+			opts.Language, t.modelPath, whisper.ErrModelNotMultilingual)
+	}
+	if opts.Translate && !t.multilingual() {
+		return nil, fmt.Errorf("translation needs a multilingual model, %s is English-only: %w",
+			t.modelPath, whisper.ErrModelNotMultilingual)
+	}
+	if t.multilingual() && lang != "" && lang != LanguageAuto && t.ctx.Whisper_lang_id(lang) < 0 {
+		return nil, fmt.Errorf("failed to set language %q: %w", opts.Language, whisper.ErrUnsupportedLanguage)
+	}
+	opts.Language = lang
+	return &whisperSession{transcriber: t, opts: opts}, nil
+}
+
+// Close releases the model.
+func (t *WhisperTranscriber) Close() error {
+	if t.ctx != nil {
+		t.ctx.Whisper_free()
+		t.ctx = nil
+	}
+	return nil
+}
+
+// isText reports whether token is part of the text rather than a timestamp
+// or control token.
+func (t *WhisperTranscriber) isText(token whisper.Token) bool {
+	id := whispercpp.Token(token.Id)
+	switch {
+	case id >= t.ctx.Whisper_token_eot():
+		// Timestamps and the other special tokens all come after EOT
+		return false
+	case id == t.ctx.Whisper_token_sot(), id == t.ctx.Whisper_token_prev(),
+		id == t.ctx.Whisper_token_solm(), id == t.ctx.Whisper_token_not():
+		return false
+	}
+	return true
+}
+
+type whisperSession struct {
+	transcriber *WhisperTranscriber
+	opts        DecodeOptions
+}
+
+// Transcribe runs whisper over samples and collects every segment.
+func (s *whisperSession) Transcribe(ctx context.Context, samples []float32) (*models.Transcript, error) {
+	select {
+	case s.transcriber.turn <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.transcriber.turn }()
+
+	if len(samples) == 0 {
+		return &models.Transcript{Language: "en"}, nil
+	}
+	wctx := s.transcriber.ctx
+	threads := runtime.NumCPU()
+	if s.opts.Threads > 0 {
+		threads = int(s.opts.Threads)
+	}
+	params := s.opts.params(wctx, threads)
+	transcript := &models.Transcript{Language: "en"}
+	if s.transcriber.multilingual() {
+		// English-only models always decode English
+		lang := languageID(wctx, s.opts.Language)
+		if lang < 0 {
+			// Detect here rather than inside whisper_full, which would run
+			// the same encoder pass but keep the probabilities to itself
+			id, probability, err := detectLanguage(wctx, samples, s.opts.Offset, threads)
+			if err != nil {
+				return nil, err
+			}
+			lang, transcript.LanguageProbability = id, probability
+		}
+		if err := params.SetLanguage(lang); err != nil {
+			return nil, fmt.Errorf("failed to set language %q: %v", s.opts.Language, err)
+		}
+	}
+
+	// whisper asks before encoding every 30s window whether to go on
+	keepGoing := func() bool { return ctx.Err() == nil }
+	var onProgress func(int)
+	if report := progressFrom(ctx); report != nil {
+		onProgress = func(percent int) { report(float64(percent) / 100) }
+	}
+	if err := wctx.Whisper_full(params, samples, keepGoing, nil, onProgress); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to process audio: %v", err)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if s.transcriber.multilingual() {
+		transcript.Language = whispercpp.Whisper_lang_str(wctx.Whisper_full_lang_id())
+	}
+
+	var results []models.SegmentResult
+	for n := 0; n < wctx.Whisper_full_n_segments(); n++ {
+		tokens := segmentTokens(wctx, n)
+		result := models.SegmentResult{
+			Start: whisperTime(wctx.Whisper_full_get_segment_t0(n)),
+			End:   whisperTime(wctx.Whisper_full_get_segment_t1(n)),
+			Text:  strings.TrimSpace(wctx.Whisper_full_get_segment_text(n)),
+		}
+		result.AvgProbability, result.MinProbability = tokenConfidence(s.transcriber.isText, tokens)
+		if s.opts.WordTimestamps {
+			result.Words = groupWords(s.transcriber.isText, tokens)
+		}
+		results = append(results, result)
+	}
+	transcript.Segments = results
+	return transcript, nil
+}
+
+// params returns the whisper parameters of one decode: beam search when
+// BeamSize is above 1, greedy otherwise, with the tuning of d applied.
+func (d DecodeOptions) params(wctx *whispercpp.Context, threads int) whispercpp.Params {
+	strategy := whispercpp.SAMPLING_GREEDY
+	if d.BeamSize > 1 {
+		strategy = whispercpp.SAMPLING_BEAM_SEARCH
+	}
+	params := wctx.Whisper_full_default_params(strategy)
+	if d.BeamSize > 1 {
+		params.SetBeamSize(int(d.BeamSize))
+	}
+	if d.BestOf > 0 {
+		setBestOf(&params, int(d.BestOf))
+	}
+
+	// Keep whisper quiet and every call independent of the one before
+	params.SetPrintSpecial(false)
+	params.SetPrintProgress(false)
+	params.SetPrintRealtime(false)
+	params.SetPrintTimestamps(false)
+	params.SetNoContext(true)
+	params.SetThreads(threads)
+
+	// Segment length limits are applied on token timestamps
+	if d.WordTimestamps || d.MaxSegmentLength > 0 {
+		params.SetTokenTimestamps(true)
+	}
+	params.SetTranslate(d.Translate)
+	if d.InitialPrompt != "" {
+		params.SetInitialPrompt(d.InitialPrompt)
+	}
+	if d.Temperature > 0 {
+		params.SetTemperature(d.Temperature)
+	}
+	if d.TemperatureFallback != 0 {
+		params.SetTemperatureFallback(d.TemperatureFallback)
+	}
+	if d.EntropyThreshold > 0 {
+		params.SetEntropyThold(d.EntropyThreshold)
+	}
+	if d.MaxSegmentLength > 0 {
+		params.SetMaxSegmentLength(int(d.MaxSegmentLength))
+		params.SetSplitOnWord(d.SplitOnWord)
+	}
+	if d.MaxTokensPerSegment > 0 {
+		params.SetMaxTokensPerSegment(int(d.MaxTokensPerSegment))
+	}
+	if d.Offset > 0 {
+		params.SetOffset(int(d.Offset.Milliseconds()))
+	}
+	if d.Duration > 0 {
+		params.SetDuration(int(d.Duration.Milliseconds()))
+	}
+	return params
+}
+
+// languageID returns the whisper id of lang, or -1 to detect it.
+// NewSession has already rejected unknown languages.
+func languageID(wctx *whispercpp.Context, lang string) int {
+	if lang == "" {
+		lang = "en"
+	}
+	if lang == LanguageAuto {
+		return -1
+	}
+	return wctx.Whisper_lang_id(lang)
+}
+
+// segmentTokens returns the tokens of segment n with their times.
+func segmentTokens(wctx *whispercpp.Context, n int) []whisper.Token {
+	tokens := make([]whisper.Token, wctx.Whisper_full_n_tokens(n))
+	for i := range tokens {
+		data := wctx.Whisper_full_get_token_data(n, i)
+		tokens[i] = whisper.Token{
+			Id:    int(wctx.Whisper_full_get_token_id(n, i)),
+			Text:  wctx.Whisper_full_get_token_text(n, i),
+			P:     wctx.Whisper_full_get_token_p(n, i),
+			Start: whisperTime(data.T0()),
+			End:   whisperTime(data.T1()),
+		}
+	}
+	return tokens
+}
+
+// whisperTime converts whisper's timestamps, which count 10ms steps.
+func whisperTime(t int64) time.Duration {
+	return time.Duration(t) * 10 * time.Millisecond
+}
+
+// detectLanguage runs whisper's language detection on the 30s of samples
+// from offset and returns the most likely language with its probability.
+func detectLanguage(wctx *whispercpp.Context, samples []float32, offset time.Duration, threads int) (int, float32, error) {
+	if err := wctx.Whisper_pcm_to_mel(samples, threads); err != nil {
+		return 0, 0, fmt.Errorf("failed to detect language: %v", err)
+	}
+	probs, err := wctx.Whisper_lang_auto_detect(int(offset.Milliseconds()), threads)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to detect language: %v", err)
+	}
+	best := 0
+	for id := 1; id < len(probs) && id <= whispercpp.Whisper_lang_max_id(); id++ {
+		if probs[id] > probs[best] {
+			best = id
+		}
+	}
+	return best, probs[best], nil
+}
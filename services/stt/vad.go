@@ -0,0 +1,192 @@
+package stt
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"sts/internal/models"
+)
+
+// SampleRate is the rate every sample buffer in this package is at.
+const SampleRate = 16000
+
+// VADOptions configures the energy-based voice activity detector.
+type VADOptions struct {
+	Enabled bool
+
+	// Frame is the analysis window the energy is measured over.
+	Frame time.Duration
+
+	// ThresholdDB is how far above the noise floor a frame must be to count
+	// as speech. The noise floor is the 10th percentile of frame energies.
+	ThresholdDB float64
+
+	// MaxFloorDB caps the noise floor in dBFS. Audio that is speech nearly
+	// throughout has its 10th percentile in the speech itself, which would
+	// put the threshold above every word. Zero leaves the floor uncapped.
+	MaxFloorDB float64
+
+	// MinSpeech drops speech bursts shorter than this (clicks, bumps).
+	MinSpeech time.Duration
+
+	// MinSilence merges speech separated by shorter pauses.
+	MinSilence time.Duration
+
+	// Padding is kept around every region so word onsets are not clipped.
+	Padding time.Duration
+
+	// Gap is the silence inserted between regions before they are handed to
+	// whisper, so it still sees a pause where one was cut out.
+	Gap time.Duration
+}
+
+// DefaultVADOptions returns settings tuned for speech recorded on a phone
+// or laptop microphone. The detector is disabled.
+func DefaultVADOptions() VADOptions {
+	return VADOptions{
+		Frame:       30 * time.Millisecond,
+		ThresholdDB: 12,
+		MaxFloorDB:  -50,
+		MinSpeech:   250 * time.Millisecond,
+		MinSilence:  700 * time.Millisecond,
+		Padding:     200 * time.Millisecond,
+		Gap:         300 * time.Millisecond,
+	}
+}
+
+// SpeechRegion is a span of samples, [Start, End), that contains speech.
+type SpeechRegion struct {
+	Start, End int
+}
+
+// Duration returns the length of the region.
+func (r SpeechRegion) Duration() time.Duration {
+	return samplesToDuration(r.End - r.Start)
+}
+
+// DetectSpeech returns the speech regions of 16 kHz mono samples in order.
+func DetectSpeech(samples []float32, opts VADOptions) []SpeechRegion {
+	frameLen := durationToSamples(opts.Frame)
+	if frameLen <= 0 || len(samples) == 0 {
+		return nil
+	}
+
+	// Energy of every frame in dBFS
+	numFrames := (len(samples) + frameLen - 1) / frameLen
+	energies := make([]float64, numFrames)
+	for f := 0; f < numFrames; f++ {
+		start := f * frameLen
+		end := min(start+frameLen, len(samples))
+		var sum float64
+		for _, v := range samples[start:end] {
+			sum += float64(v) * float64(v)
+		}
+		rms := math.Sqrt(sum / float64(end-start))
+		energies[f] = 20 * math.Log10(rms+1e-10)
+	}
+
+	sorted := append([]float64(nil), energies...)
+	sort.Float64s(sorted)
+	threshold := min(sorted[len(sorted)/10], opts.MaxFloorDB) + opts.ThresholdDB
+
+	// Raw runs of loud frames
+	var regions []SpeechRegion
+	inSpeech := false
+	for f, e := range energies {
+		switch {
+		case e >= threshold && !inSpeech:
+			regions = append(regions, SpeechRegion{Start: f * frameLen})
+			inSpeech = true
+		case e < threshold && inSpeech:
+			regions[len(regions)-1].End = f * frameLen
+			inSpeech = false
+		}
+	}
+	if inSpeech {
+		regions[len(regions)-1].End = len(samples)
+	}
+
+	// Bridge short pauses, then drop short bursts
+	minSilence := durationToSamples(opts.MinSilence)
+	var merged []SpeechRegion
+	for _, r := range regions {
+		if n := len(merged); n > 0 && r.Start-merged[n-1].End < minSilence {
+			merged[n-1].End = r.End
+			continue
+		}
+		merged = append(merged, r)
+	}
+	minSpeech := durationToSamples(opts.MinSpeech)
+	padding := durationToSamples(opts.Padding)
+	var result []SpeechRegion
+	for _, r := range merged {
+		if r.End-r.Start < minSpeech {
+			continue
+		}
+		r.Start = max(r.Start-padding, 0)
+		r.End = min(r.End+padding, len(samples))
+		if n := len(result); n > 0 && r.Start <= result[n-1].End {
+			result[n-1].End = r.End
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// transcribeSpeech runs session over the speech regions only. The regions
+// are packed into one buffer with opts.Gap of silence between them, and the
+// resulting timestamps are mapped back onto the original timeline.
+func transcribeSpeech(ctx context.Context, session Session, samples []float32, regions []SpeechRegion, opts VADOptions) (*models.Transcript, error) {
+	if len(regions) == 0 {
+		return &models.Transcript{}, nil
+	}
+
+	gap := durationToSamples(opts.Gap)
+	packed := make([]float32, 0, len(samples))
+	offsets := make([]int, len(regions)) // start of every region in packed
+	for i, r := range regions {
+		if i > 0 {
+			packed = append(packed, make([]float32, gap)...)
+		}
+		offsets[i] = len(packed)
+		packed = append(packed, samples[r.Start:r.End]...)
+	}
+
+	transcript, err := session.Transcribe(ctx, packed)
+	if err != nil {
+		return nil, err
+	}
+
+	remap := func(t time.Duration) time.Duration {
+		pos := durationToSamples(t)
+		// last region starting at or before pos
+		i := sort.Search(len(offsets), func(i int) bool { return offsets[i] > pos }) - 1
+		if i < 0 {
+			i = 0
+		}
+		original := regions[i].Start + (pos - offsets[i])
+		original = min(original, regions[i].End)
+		return samplesToDuration(original)
+	}
+	for i := range transcript.Segments {
+		seg := &transcript.Segments[i]
+		seg.Start = remap(seg.Start)
+		seg.End = remap(seg.End)
+		for j := range seg.Words {
+			seg.Words[j].Start = remap(seg.Words[j].Start)
+			seg.Words[j].End = remap(seg.Words[j].End)
+		}
+	}
+	return transcript, nil
+}
+
+func durationToSamples(d time.Duration) int {
+	return int(d * SampleRate / time.Second)
+}
+
+func samplesToDuration(n int) time.Duration {
+	return time.Duration(n) * time.Second / SampleRate
+}
@@ -0,0 +1,158 @@
+package stt
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"sts/internal/models"
+)
+
+// tone is a span of a synthetic signal: a 440 Hz tone at amplitude, or
+// faint noise when amplitude is zero.
+type tone struct {
+	length    time.Duration
+	amplitude float64
+}
+
+func synth(parts ...tone) []float32 {
+	rng := rand.New(rand.NewSource(1))
+	var samples []float32
+	for _, p := range parts {
+		for i := 0; i < durationToSamples(p.length); i++ {
+			v := 0.001 * (rng.Float64()*2 - 1)
+			if p.amplitude > 0 {
+				v = p.amplitude * math.Sin(2*math.Pi*440*float64(len(samples))/SampleRate)
+			}
+			samples = append(samples, float32(v))
+		}
+	}
+	return samples
+}
+
+func ms(n int) time.Duration { return time.Duration(n) * time.Millisecond }
+
+// at returns the sample index of a time given in milliseconds.
+func at(n int) int { return durationToSamples(ms(n)) }
+
+func TestDetectSpeech(t *testing.T) {
+	frame := at(30)
+	tests := []struct {
+		name       string
+		minSilence time.Duration // overrides the default when set
+		signal     []tone
+		want       []SpeechRegion
+	}{
+		{
+			name:   "silence",
+			signal: []tone{{ms(3000), 0}},
+		},
+		{
+			name:   "padded burst",
+			signal: []tone{{ms(990), 0}, {ms(990), 0.3}, {ms(990), 0}},
+			want:   []SpeechRegion{{at(990) - at(200), at(1980) + at(200)}},
+		},
+		{
+			name:   "short pause bridged",
+			signal: []tone{{ms(990), 0}, {ms(600), 0.3}, {ms(300), 0}, {ms(600), 0.3}, {ms(990), 0}},
+			want:   []SpeechRegion{{at(990) - at(200), at(2490) + at(200)}},
+		},
+		{
+			name:   "long pause splits",
+			signal: []tone{{ms(990), 0}, {ms(600), 0.3}, {ms(1500), 0}, {ms(600), 0.3}, {ms(990), 0}},
+			want: []SpeechRegion{
+				{at(990) - at(200), at(1590) + at(200)},
+				{at(3090) - at(200), at(3690) + at(200)},
+			},
+		},
+		{
+			name:       "paddings overlap",
+			minSilence: ms(100),
+			signal:     []tone{{ms(990), 0}, {ms(600), 0.3}, {ms(300), 0}, {ms(600), 0.3}, {ms(990), 0}},
+			want:       []SpeechRegion{{at(990) - at(200), at(2490) + at(200)}},
+		},
+		{
+			name:   "click dropped",
+			signal: []tone{{ms(990), 0}, {ms(90), 0.5}, {ms(990), 0}},
+		},
+		{
+			name:   "padding clipped at the edges",
+			signal: []tone{{ms(600), 0.3}, {ms(1500), 0}, {ms(600), 0.3}},
+			want:   []SpeechRegion{{0, at(600) + at(200)}, {at(2100) - at(200), at(2700)}},
+		},
+		{
+			// The floor is in the speech, capped it still finds all of it
+			name:   "continuous speech",
+			signal: []tone{{ms(3000), 0.3}},
+			want:   []SpeechRegion{{0, at(3000)}},
+		},
+		{
+			name:   "quiet speech over a quiet floor",
+			signal: []tone{{ms(990), 0}, {ms(990), 0.01}, {ms(990), 0}},
+			want:   []SpeechRegion{{at(990) - at(200), at(1980) + at(200)}},
+		},
+	}
+	for _, tt := range tests {
+		opts := DefaultVADOptions()
+		if tt.minSilence > 0 {
+			opts.MinSilence = tt.minSilence
+		}
+		got := DetectSpeech(synth(tt.signal...), opts)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: regions %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			// Edges land on frame boundaries
+			if abs(got[i].Start-tt.want[i].Start) > frame || abs(got[i].End-tt.want[i].End) > frame {
+				t.Errorf("%s: regions %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// echoSession returns one segment spanning the samples it was given.
+type echoSession struct {
+	got []float32
+}
+
+func (s *echoSession) Transcribe(ctx context.Context, samples []float32) (*models.Transcript, error) {
+	s.got = samples
+	end := samplesToDuration(len(samples))
+	return &models.Transcript{Segments: []models.SegmentResult{
+		{Start: 0, End: ms(500), Text: "first"},
+		{Start: end - ms(500), End: end, Text: "second"},
+	}}, nil
+}
+
+func TestTranscribeSpeechMapsTimesBack(t *testing.T) {
+	opts := DefaultVADOptions()
+	samples := make([]float32, at(10000))
+	regions := []SpeechRegion{{at(1000), at(2000)}, {at(6000), at(8000)}}
+
+	session := &echoSession{}
+	transcript, err := transcribeSpeech(context.Background(), session, samples, regions, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := at(1000) + at(300) + at(2000); len(session.got) != want {
+		t.Errorf("packed %d samples, want %d", len(session.got), want)
+	}
+	first, second := transcript.Segments[0], transcript.Segments[1]
+	if first.Start != ms(1000) || first.End != ms(1500) {
+		t.Errorf("first segment at %s-%s, want 1s-1.5s", first.Start, first.End)
+	}
+	if second.Start != ms(7500) || second.End != ms(8000) {
+		t.Errorf("second segment at %s-%s, want 7.5s-8s", second.Start, second.End)
+	}
+}
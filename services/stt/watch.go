@@ -0,0 +1,234 @@
+package stt
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WatchOptions configures WatchVideos.
+type WatchOptions struct {
+	// Interval between two scans of the video folder.
+	Interval time.Duration
+
+	// Settle is how long a file's size and modification time must stay the
+	// same before it counts as fully uploaded.
+	Settle time.Duration
+}
+
+// DefaultWatchOptions scans every 2s and waits for 10s of quiet.
+func DefaultWatchOptions() WatchOptions {
+	return WatchOptions{Interval: 2 * time.Second, Settle: 10 * time.Second}
+}
+
+// WatchVideos processes files as they land in opts.VideoDir until ctx is
+// done. The folder is polled rather than watched with inotify so it works
+// the same on every platform and on network mounts.
+//
+// Every file already in the folder is queued once on start; the manifest
+// skips those whose outputs are up to date, so a restart only redoes what
+// was missing. A file that changes after it was processed is processed
+// again. Cancelling ctx stops the scans and aborts the files in progress,
+// removing their partial outputs, and WatchVideos returns nil.
+func WatchVideos(ctx context.Context, opts Options, watch WatchOptions, logger *log.Logger) error {
+	defaults := DefaultWatchOptions()
+	if watch.Interval <= 0 {
+		watch.Interval = defaults.Interval
+	}
+	if watch.Settle < 0 {
+		watch.Settle = 0
+	}
+
+	if err := ensureFolders(opts, logger); err != nil {
+		return err
+	}
+	b, err := openBatch(opts, map[string]time.Duration{}, logger)
+	if err != nil {
+		return err
+	}
+	defer b.transcriber.Close()
+
+	// b.opts carries the folder prompt and glossary openBatch loaded
+	workers := max(opts.Workers, 1)
+	decode := b.opts.Decode
+	decode.Threads = b.opts.decodeThreads()
+
+	wt := &watcher{batch: b, watch: watch, files: map[string]*watchedFile{}}
+	jobs := make(chan mediaJob)
+	var wg sync.WaitGroup
+
+	logger.Printf("Watching %s/ with %d worker(s)", opts.VideoDir, workers)
+	for i := 0; i < workers; i++ {
+		w, err := newWorker(b, decode)
+		if err != nil {
+			close(jobs)
+			wg.Wait()
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				err := w.processWithTimeout(ctx, job.path, job.info)
+				if err != nil && ctx.Err() == nil {
+					logger.Printf("Error processing %s: %v", job.path, err)
+				}
+				wt.processed(job.path)
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(watch.Interval)
+	defer ticker.Stop()
+	queue := wt.scan(ctx)
+	for {
+		// Only offer a job while there is one, without blocking the scans
+		var send chan<- mediaJob
+		var next mediaJob
+		if len(queue) > 0 {
+			send, next = jobs, queue[0]
+		}
+		select {
+		case <-ctx.Done():
+			logger.Printf("Stopping watch of %s/ (%d queued file(s) left for the next run)", opts.VideoDir, len(queue))
+			close(jobs)
+			wg.Wait()
+			wt.saveIndex()
+			return nil
+		case send <- next:
+			queue = queue[1:]
+		case <-ticker.C:
+			// Saved at most once per scan, however many files finished
+			wt.saveIndex()
+			queue = append(queue, wt.scan(ctx)...)
+		}
+	}
+}
+
+// watcher tracks every file of the watched folder between scans.
+type watcher struct {
+	*batch
+	watch WatchOptions
+
+	mu    sync.Mutex
+	files map[string]*watchedFile
+}
+
+type watchState int
+
+const (
+	fileSettling watchState = iota // changed recently, maybe still uploading
+	fileQueued                     // queued or being processed
+	fileHandled                    // processed, failed or ignored
+)
+
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // when size and modTime were last seen changing
+	state   watchState
+	changed bool // changed while queued, settles again once processed
+}
+
+// scan lists the folder and returns the files that settled since the last
+// scan and have an audio stream.
+func (wt *watcher) scan(ctx context.Context) []mediaJob {
+	entries, err := os.ReadDir(wt.opts.VideoDir)
+	if err != nil {
+		wt.logger.Printf("Failed to read video folder: %v", err)
+		return nil
+	}
+
+	now := time.Now()
+	var settled []string
+	present := map[string]bool{}
+
+	wt.mu.Lock()
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // removed since the listing
+		}
+		path := filepath.Join(wt.opts.VideoDir, entry.Name())
+		present[path] = true
+
+		f, ok := wt.files[path]
+		switch {
+		case !ok:
+			wt.files[path] = &watchedFile{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		case f.size != info.Size() || !f.modTime.Equal(info.ModTime()):
+			// Still growing, or changed after it was queued or processed. A
+			// queued file keeps its state so it is never queued twice at
+			// once; processed lets it settle again.
+			f.size, f.modTime, f.since = info.Size(), info.ModTime(), now
+			if f.state == fileQueued {
+				f.changed = true
+			} else {
+				f.state = fileSettling
+			}
+			continue
+		}
+		if f.state == fileSettling && now.Sub(f.since) >= wt.watch.Settle {
+			settled = append(settled, path)
+		}
+	}
+	for path, f := range wt.files {
+		// Queued files are kept until processed reports back
+		if !present[path] && f.state != fileQueued {
+			delete(wt.files, path)
+		}
+	}
+	wt.mu.Unlock()
+
+	// Probe outside the lock, workers report back through it
+	var queue []mediaJob
+	for _, path := range settled {
+		state := fileHandled
+		info, err := ProbeMedia(ctx, path)
+		switch {
+		case ctx.Err() != nil:
+			return queue
+		case err != nil:
+			wt.logger.Printf("Ignoring %s (not a media file: %v)", filepath.Base(path), err)
+		case !info.HasAudio:
+			wt.logger.Printf("Ignoring %s (no audio stream)", filepath.Base(path))
+		default:
+			state = fileQueued
+			wt.progress.add(path, info.Duration)
+			queue = append(queue, mediaJob{path: path, info: info})
+		}
+		wt.setState(path, fileSettling, state)
+	}
+	return queue
+}
+
+// processed marks path as handled once a worker is done with it, unless it
+// changed in the meantime and has to settle again.
+func (wt *watcher) processed(path string) {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	f, ok := wt.files[path]
+	if !ok || f.state != fileQueued {
+		return
+	}
+	f.state = fileHandled
+	if f.changed {
+		f.state, f.changed = fileSettling, false
+	}
+}
+
+func (wt *watcher) setState(path string, from, to watchState) {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	if f, ok := wt.files[path]; ok && f.state == from {
+		f.state = to
+	}
+}
@@ -0,0 +1,112 @@
+package stt
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestWatcher(t *testing.T) *watcher {
+	t.Helper()
+	opts := DefaultOptions()
+	opts.VideoDir = t.TempDir()
+	b := &batch{opts: opts, logger: log.New(io.Discard, "", 0)}
+	return &watcher{batch: b, files: map[string]*watchedFile{}}
+}
+
+func TestWatchScanQueuesSettledFilesOnce(t *testing.T) {
+	wt := newTestWatcher(t)
+	ctx := context.Background()
+	clip := filepath.Join(wt.opts.VideoDir, "clip.wav")
+	writeTestWav(t, clip, SampleRate, make([]int16, SampleRate))
+	if err := os.WriteFile(filepath.Join(wt.opts.VideoDir, "notes.txt"), []byte("not media"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(wt.opts.VideoDir, ".hidden.wav"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := func(step string, want ...string) {
+		t.Helper()
+		got := wt.scan(ctx)
+		if len(got) != len(want) || (len(want) == 1 && got[0].path != want[0]) {
+			t.Fatalf("%s: scan queued %v, want %q", step, got, want)
+		}
+		for _, job := range got {
+			if job.info == nil || !job.info.HasAudio {
+				t.Fatalf("%s: %s queued without its probe result", step, job.path)
+			}
+		}
+	}
+
+	expect("first sight")
+	expect("settled", clip)
+	expect("in flight")
+
+	// A change while in flight must not queue it a second time
+	writeTestWav(t, clip, SampleRate, make([]int16, 2*SampleRate))
+	expect("changed in flight")
+	expect("still in flight")
+	if f := wt.files[clip]; f.state != fileQueued || !f.changed {
+		t.Fatalf("state after change in flight = %+v", f)
+	}
+
+	wt.processed(clip)
+	expect("settled again", clip)
+	wt.processed(clip)
+	expect("handled")
+	if f := wt.files[clip]; f.state != fileHandled {
+		t.Errorf("state = %v, want handled", f.state)
+	}
+	if f := wt.files[filepath.Join(wt.opts.VideoDir, "notes.txt")]; f == nil || f.state != fileHandled {
+		t.Errorf("non-media file not marked handled: %+v", f)
+	}
+	if _, ok := wt.files[filepath.Join(wt.opts.VideoDir, ".hidden.wav")]; ok {
+		t.Error("hidden file watched")
+	}
+
+	// Changed after processing, it is transcribed again
+	writeTestWav(t, clip, SampleRate, make([]int16, 3*SampleRate))
+	expect("changed after processing")
+	expect("settled after change", clip)
+}
+
+func TestWatchScanKeepsRemovedQueuedFiles(t *testing.T) {
+	wt := newTestWatcher(t)
+	ctx := context.Background()
+	clip := filepath.Join(wt.opts.VideoDir, "clip.wav")
+	writeTestWav(t, clip, SampleRate, make([]int16, SampleRate))
+	wt.scan(ctx)
+	if got := wt.scan(ctx); len(got) != 1 {
+		t.Fatalf("scan queued %v", got)
+	}
+
+	// Removed and put back while in flight: still only queued once
+	if err := os.Remove(clip); err != nil {
+		t.Fatal(err)
+	}
+	wt.scan(ctx)
+	writeTestWav(t, clip, SampleRate, make([]int16, 2*SampleRate))
+	for i := 0; i < 2; i++ {
+		if got := wt.scan(ctx); len(got) != 0 {
+			t.Fatalf("requeued in flight: %v", got)
+		}
+	}
+	wt.processed(clip)
+	if got := wt.scan(ctx); len(got) != 1 {
+		t.Fatalf("after processing, scan queued %v", got)
+	}
+
+	// Removed once handled, it is forgotten
+	wt.processed(clip)
+	if err := os.Remove(clip); err != nil {
+		t.Fatal(err)
+	}
+	wt.scan(ctx)
+	if _, ok := wt.files[clip]; ok {
+		t.Error("removed file still watched")
+	}
+}
@@ -0,0 +1,259 @@
+package stt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// WAV format tags of the fmt chunk.
+const (
+	wavFormatPCM        = 0x0001
+	wavFormatFloat      = 0x0003
+	wavFormatExtensible = 0xFFFE
+)
+
+// Speaker position bit of the low-frequency channel in the channel mask of
+// WAVE_FORMAT_EXTENSIBLE files. It carries no speech and is left out of the
+// downmix.
+const wavSpeakerLFE = 0x8
+
+// wavFormat is the parsed fmt chunk.
+type wavFormat struct {
+	Float       bool
+	Channels    int
+	SampleRate  int
+	BitsPerSamp int
+	BlockAlign  int
+	ChannelMask uint32
+}
+
+// codec returns the ffprobe name of the sample format, e.g. "pcm_s24le".
+func (f wavFormat) codec() string {
+	switch {
+	case f.Float:
+		return fmt.Sprintf("pcm_f%dle", f.BitsPerSamp)
+	case f.BitsPerSamp == 8:
+		return "pcm_u8"
+	default:
+		return fmt.Sprintf("pcm_s%dle", f.BitsPerSamp)
+	}
+}
+
+// wavHeader reads the RIFF header up to the start of the data chunk and
+// returns the format and the data size, or -1 when the size is unknown as
+// in WAVs streamed from a pipe.
+func wavHeader(r io.Reader) (wavFormat, int64, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return wavFormat{}, 0, fmt.Errorf("not a wav file: %v", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return wavFormat{}, 0, errors.New("not a RIFF/WAVE file")
+	}
+
+	var format wavFormat
+	haveFormat := false
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return wavFormat{}, 0, fmt.Errorf("no data chunk: %v", err)
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+
+		switch id {
+		case "fmt ":
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return wavFormat{}, 0, fmt.Errorf("short fmt chunk: %v", err)
+			}
+			var err error
+			if format, err = parseWavFormat(body); err != nil {
+				return wavFormat{}, 0, err
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return wavFormat{}, 0, errors.New("data chunk before fmt chunk")
+			}
+			// ffmpeg writing to a pipe leaves the size at 0 or 0xFFFFFFFF
+			if size == 0 || size == math.MaxUint32 {
+				size = -1
+			}
+			return format, size, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return wavFormat{}, 0, fmt.Errorf("short %q chunk: %v", id, err)
+			}
+		}
+		// Chunks are padded to an even size
+		if size%2 == 1 {
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return wavFormat{}, 0, err
+			}
+		}
+	}
+}
+
+func parseWavFormat(body []byte) (wavFormat, error) {
+	if len(body) < 16 {
+		return wavFormat{}, errors.New("fmt chunk too short")
+	}
+	tag := binary.LittleEndian.Uint16(body[0:2])
+	f := wavFormat{
+		Channels:    int(binary.LittleEndian.Uint16(body[2:4])),
+		SampleRate:  int(binary.LittleEndian.Uint32(body[4:8])),
+		BlockAlign:  int(binary.LittleEndian.Uint16(body[12:14])),
+		BitsPerSamp: int(binary.LittleEndian.Uint16(body[14:16])),
+	}
+	if tag == wavFormatExtensible {
+		if len(body) < 40 {
+			return wavFormat{}, errors.New("extensible fmt chunk too short")
+		}
+		// Fewer valid bits than BitsPerSamp are left-aligned in their
+		// container, so decoding the whole container is still right
+		f.ChannelMask = binary.LittleEndian.Uint32(body[20:24])
+		// The sub-format GUID starts with the plain format tag
+		tag = binary.LittleEndian.Uint16(body[24:26])
+	}
+
+	switch tag {
+	case wavFormatPCM:
+		switch f.BitsPerSamp {
+		case 8, 16, 24, 32:
+		default:
+			return wavFormat{}, fmt.Errorf("unsupported integer bit depth %d", f.BitsPerSamp)
+		}
+	case wavFormatFloat:
+		if f.BitsPerSamp != 32 && f.BitsPerSamp != 64 {
+			return wavFormat{}, fmt.Errorf("unsupported float bit depth %d", f.BitsPerSamp)
+		}
+		f.Float = true
+	default:
+		return wavFormat{}, fmt.Errorf("unsupported wav format 0x%04x", tag)
+	}
+	if f.Channels < 1 || f.SampleRate < 1 {
+		return wavFormat{}, fmt.Errorf("invalid wav format: %d channels at %d Hz", f.Channels, f.SampleRate)
+	}
+	if f.BlockAlign < f.Channels*f.BitsPerSamp/8 {
+		f.BlockAlign = f.Channels * f.BitsPerSamp / 8
+	}
+	return f, nil
+}
+
+// decodeWav reads the samples of r downmixed to mono, in [-1, 1].
+func decodeWav(r io.Reader) ([]float32, wavFormat, error) {
+	br := bufio.NewReaderSize(r, 64*1024)
+	format, size, err := wavHeader(br)
+	if err != nil {
+		return nil, format, err
+	}
+
+	var data io.Reader = br
+	var capacity int
+	if size >= 0 {
+		data = io.LimitReader(br, size)
+		capacity = int(size) / format.BlockAlign
+	}
+
+	// Average the channels that carry sound
+	mix := make([]int, 0, format.Channels)
+	for ch := 0; ch < format.Channels; ch++ {
+		if format.Channels > 2 && channelSpeaker(format.ChannelMask, ch) == wavSpeakerLFE {
+			continue
+		}
+		mix = append(mix, ch)
+	}
+	sampleSize := format.BitsPerSamp / 8
+	gain := 1 / float64(len(mix))
+
+	samples := make([]float32, 0, capacity)
+	block := make([]byte, format.BlockAlign*4096)
+	for {
+		n, err := io.ReadFull(data, block)
+		// A trailing partial frame is dropped
+		for frame := 0; frame+format.BlockAlign <= n; frame += format.BlockAlign {
+			var sum float64
+			for _, ch := range mix {
+				sum += wavSample(block[frame+ch*sampleSize:], format)
+			}
+			samples = append(samples, float32(sum*gain))
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return samples, format, nil
+		}
+		if err != nil {
+			return nil, format, err
+		}
+	}
+}
+
+// wavSample decodes one little-endian sample to [-1, 1].
+func wavSample(b []byte, f wavFormat) float64 {
+	if f.Float {
+		if f.BitsPerSamp == 64 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+	switch f.BitsPerSamp {
+	case 8:
+		// 8-bit WAV is unsigned with its midpoint at 128
+		return (float64(b[0]) - 128) / 128
+	case 16:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 24:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+// channelSpeaker returns the speaker position bit of channel ch: the n-th
+// set bit of mask. It is 0 when the mask does not cover the channel.
+func channelSpeaker(mask uint32, ch int) uint32 {
+	for bit := uint32(1); bit != 0; bit <<= 1 {
+		if mask&bit == 0 {
+			continue
+		}
+		if ch == 0 {
+			return bit
+		}
+		ch--
+	}
+	return 0
+}
+
+// probeWav reads only the header of a WAV file, for when ffprobe is not
+// installed.
+func probeWav(path string) (*MediaInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format, size, err := wavHeader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	info := &MediaInfo{
+		HasAudio:   true,
+		Format:     "wav",
+		AudioCodec: format.codec(),
+		SampleRate: format.SampleRate,
+		Channels:   format.Channels,
+	}
+	if size >= 0 {
+		frames := size / int64(format.BlockAlign)
+		info.Duration = time.Duration(frames) * time.Second / time.Duration(format.SampleRate)
+	}
+	return info, nil
+}
@@ -0,0 +1,116 @@
+package stt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// wavBytes builds a WAV file from raw frames. A non-zero mask writes a
+// WAVE_FORMAT_EXTENSIBLE fmt chunk with tag as its sub-format. An odd
+// sized chunk is put before the data to check chunk padding.
+func wavBytes(tag uint16, channels, bits int, mask uint32, frames []byte) []byte {
+	block := channels * bits / 8
+	fmtChunk := new(bytes.Buffer)
+	header := tag
+	if mask != 0 {
+		header = wavFormatExtensible
+	}
+	fmtChunk.Write(le(header, uint16(channels), uint32(SampleRate), uint32(SampleRate*block), uint16(block), uint16(bits)))
+	if mask != 0 {
+		fmtChunk.Write(le(uint16(22), uint16(bits), mask, tag))
+		fmtChunk.Write(make([]byte, 14)) // rest of the sub-format GUID
+	}
+
+	body := new(bytes.Buffer)
+	body.WriteString("WAVE")
+	body.WriteString("fmt ")
+	binary.Write(body, binary.LittleEndian, uint32(fmtChunk.Len()))
+	body.Write(fmtChunk.Bytes())
+	body.WriteString("LIST")
+	binary.Write(body, binary.LittleEndian, uint32(3))
+	body.Write([]byte{1, 2, 3, 0})
+	body.WriteString("data")
+	binary.Write(body, binary.LittleEndian, uint32(len(frames)))
+	body.Write(frames)
+
+	out := new(bytes.Buffer)
+	out.WriteString("RIFF")
+	binary.Write(out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+func le(values ...any) []byte {
+	buf := new(bytes.Buffer)
+	for _, v := range values {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeWav(t *testing.T) {
+	tests := []struct {
+		name     string
+		tag      uint16
+		channels int
+		bits     int
+		mask     uint32
+		frames   []byte
+		codec    string
+		want     []float32
+	}{
+		{"8-bit", wavFormatPCM, 1, 8, 0, []byte{128, 192, 0}, "pcm_u8", []float32{0, 0.5, -1}},
+		{"16-bit", wavFormatPCM, 1, 16, 0, le(int16(0), int16(16384), int16(-32768)), "pcm_s16le", []float32{0, 0.5, -1}},
+		{"24-bit", wavFormatPCM, 1, 24, 0, []byte{0, 0, 0, 0, 0, 0x40, 0, 0, 0x80}, "pcm_s24le", []float32{0, 0.5, -1}},
+		{"32-bit", wavFormatPCM, 1, 32, 0, le(int32(0), int32(1<<30), int32(math.MinInt32)), "pcm_s32le", []float32{0, 0.5, -1}},
+		{"float32", wavFormatFloat, 1, 32, 0, le(float32(0), float32(0.5), float32(-1)), "pcm_f32le", []float32{0, 0.5, -1}},
+		{"float64", wavFormatFloat, 1, 64, 0, le(0.0, 0.5, -1.0), "pcm_f64le", []float32{0, 0.5, -1}},
+		{"stereo", wavFormatPCM, 2, 16, 0, le(int16(16384), int16(-16384), int16(16384), int16(0)), "pcm_s16le", []float32{0, 0.25}},
+		{
+			// Front left, front right and LFE: the LFE channel is not mixed in
+			name: "extensible", tag: wavFormatPCM, channels: 3, bits: 16, mask: 0x1 | 0x2 | wavSpeakerLFE,
+			frames: le(int16(16384), int16(8192), int16(32767)), codec: "pcm_s16le", want: []float32{0.375},
+		},
+		{"extensible float", wavFormatFloat, 1, 32, 0x4, le(float32(0.5)), "pcm_f32le", []float32{0.5}},
+		{"partial frame", wavFormatPCM, 1, 16, 0, []byte{0, 0x40, 0}, "pcm_s16le", []float32{0.5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, format, err := decodeWav(bytes.NewReader(wavBytes(tt.tag, tt.channels, tt.bits, tt.mask, tt.frames)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format.codec() != tt.codec || format.Channels != tt.channels || format.SampleRate != SampleRate {
+				t.Errorf("format = %+v (%s)", format, format.codec())
+			}
+			if len(samples) != len(tt.want) {
+				t.Fatalf("samples = %v, want %v", samples, tt.want)
+			}
+			for i := range samples {
+				if math.Abs(float64(samples[i]-tt.want[i])) > 1e-6 {
+					t.Errorf("samples = %v, want %v", samples, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeWavRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not riff", []byte("RIFX\x00\x00\x00\x00WAVE")},
+		{"12-bit", wavBytes(wavFormatPCM, 1, 12, 0, nil)},
+		{"16-bit float", wavBytes(wavFormatFloat, 1, 16, 0, nil)},
+		{"a-law", wavBytes(0x0006, 1, 8, 0, nil)},
+	}
+	for _, tt := range tests {
+		if _, _, err := decodeWav(bytes.NewReader(tt.data)); err == nil {
+			t.Errorf("%s: decoded without error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package stt
+
+import (
+	"strings"
+
+	"github.com/ggerganov/whisper.cpp/bindings/go/pkg/whisper"
+
+	"sts/internal/models"
+)
+
+// groupWords merges the text tokens of a segment into words. Whisper emits
+// sub-word tokens where a leading space starts a new word, so every token
+// without one is glued onto the word before it.
+func groupWords(isText func(whisper.Token) bool, tokens []whisper.Token) []models.Word {
+	var words []models.Word
+	var probSum float32
+	var count int
+
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		last := &words[len(words)-1]
+		last.Text = strings.TrimSpace(last.Text)
+		last.Probability = probSum / float32(count)
+		probSum, count = 0, 0
+	}
+
+	for _, token := range tokens {
+		if !isText(token) || token.Text == "" {
+			continue
+		}
+		if count == 0 || strings.HasPrefix(token.Text, " ") {
+			flush()
+			words = append(words, models.Word{Start: token.Start})
+		}
+		last := &words[len(words)-1]
+		last.Text += token.Text
+		last.End = token.End
+		probSum += token.P
+		count++
+	}
+	flush()
+
+	// Drop words that were only whitespace
+	kept := words[:0]
+	for _, w := range words {
+		if w.Text != "" {
+			kept = append(kept, w)
+		}
+	}
+	return kept
+}
+
+// tokenConfidence returns the mean and lowest probability of the text tokens
+// of a segment, or zeros if it has none.
+func tokenConfidence(isText func(whisper.Token) bool, tokens []whisper.Token) (avg, lowest float32) {
+	var sum float32
+	var count int
+	for _, token := range tokens {
+		if !isText(token) {
+			continue
+		}
+		if count == 0 || token.P < lowest {
+			lowest = token.P
+		}
+		sum += token.P
+		count++
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return sum / float32(count), lowest
+}
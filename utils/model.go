@@ -0,0 +1,440 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ModelDir is where downloaded models are kept.
+const ModelDir = "models"
+
+// DefaultModel is the model used when none is chosen.
+const DefaultModel = "base.en"
+
+// DefaultModelMirror serves the ggml conversions of the whisper.cpp project.
+const DefaultModelMirror = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/"
+
+// Model is a whisper model known to the registry.
+type Model struct {
+	Name string
+
+	// File is the file name, both on the mirror and in ModelDir.
+	File string
+
+	// SizeMB is the approximate download size, for display.
+	SizeMB int
+
+	// SHA256 is the published hash of the file. When empty, the hash
+	// Hugging Face publishes for the file, or a <file>.sha256 next to a
+	// bundled copy, is used; a model whose hash cannot be found is not
+	// installed. A mirror never vouches for its own files.
+	SHA256 string
+
+	// Multilingual models can detect the language and translate; the .en
+	// models only transcribe English, a little more accurately.
+	Multilingual bool
+}
+
+// CheckLanguage fails when m cannot decode language or translate, so the
+// mistake shows before the model is downloaded or loaded. English-only
+// models accept "auto" and simply always find English.
+func (m Model) CheckLanguage(language string, translate bool) error {
+	if m.Multilingual {
+		return nil
+	}
+	if translate {
+		return fmt.Errorf("translation needs a multilingual model, %s is English-only", m.Name)
+	}
+	if lang := strings.ToLower(language); lang != "" && lang != "auto" && lang != "en" {
+		return fmt.Errorf("language %q needs a multilingual model, %s is English-only", language, m.Name)
+	}
+	return nil
+}
+
+// Path returns where the model is stored.
+func (m Model) Path() string {
+	return filepath.Join(ModelDir, m.File)
+}
+
+// Models are the ggml models published by whisper.cpp. The q5 and q8
+// variants are quantized: smaller and faster at a small cost in accuracy.
+// Entries without a SHA256 are checked against the hash Hugging Face
+// publishes for the file, whichever mirror serves it.
+var Models = []Model{
+	{Name: "tiny", File: "ggml-tiny.bin", SizeMB: 75, Multilingual: true},
+	{Name: "tiny.en", File: "ggml-tiny.en.bin", SizeMB: 75},
+	{Name: "tiny-q5_1", File: "ggml-tiny-q5_1.bin", SizeMB: 31, Multilingual: true},
+	{Name: "tiny.en-q5_1", File: "ggml-tiny.en-q5_1.bin", SizeMB: 31},
+	{Name: "base", File: "ggml-base.bin", SizeMB: 142, Multilingual: true},
+	{Name: "base.en", File: "ggml-base.en.bin", SizeMB: 142},
+	{Name: "base-q5_1", File: "ggml-base-q5_1.bin", SizeMB: 57, Multilingual: true},
+	{Name: "base.en-q5_1", File: "ggml-base.en-q5_1.bin", SizeMB: 57},
+	{Name: "small", File: "ggml-small.bin", SizeMB: 466, Multilingual: true},
+	{Name: "small.en", File: "ggml-small.en.bin", SizeMB: 466},
+	{Name: "small-q5_1", File: "ggml-small-q5_1.bin", SizeMB: 181, Multilingual: true},
+	{Name: "small.en-q5_1", File: "ggml-small.en-q5_1.bin", SizeMB: 181},
+	{Name: "medium", File: "ggml-medium.bin", SizeMB: 1500, Multilingual: true},
+	{Name: "medium.en", File: "ggml-medium.en.bin", SizeMB: 1500},
+	{Name: "medium-q5_0", File: "ggml-medium-q5_0.bin", SizeMB: 514, Multilingual: true},
+	{Name: "medium.en-q5_0", File: "ggml-medium.en-q5_0.bin", SizeMB: 514},
+	{Name: "large-v3", File: "ggml-large-v3.bin", SizeMB: 2900, Multilingual: true},
+	{Name: "large-v3-q5_0", File: "ggml-large-v3-q5_0.bin", SizeMB: 1100, Multilingual: true},
+	{Name: "large-v3-turbo", File: "ggml-large-v3-turbo.bin", SizeMB: 1500, Multilingual: true},
+	{Name: "large-v3-turbo-q5_0", File: "ggml-large-v3-turbo-q5_0.bin", SizeMB: 547, Multilingual: true},
+	{Name: "large-v3-turbo-q8_0", File: "ggml-large-v3-turbo-q8_0.bin", SizeMB: 834, Multilingual: true},
+}
+
+// LookupModel returns the registry entry called name.
+func LookupModel(name string) (Model, error) {
+	for _, m := range Models {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	names := make([]string, len(Models))
+	for i, m := range Models {
+		names[i] = m.Name
+	}
+	sort.Strings(names)
+	return Model{}, fmt.Errorf("unknown model %q, known models: %s", name, strings.Join(names, ", "))
+}
+
+// ModelSource says where models come from.
+type ModelSource struct {
+	// Mirror is the base URL files are downloaded from; empty means
+	// DefaultModelMirror.
+	Mirror string
+
+	// Bundle is a local folder of model files, e.g. on a shared drive,
+	// that is used before any download.
+	Bundle string
+}
+
+// checksumMirror publishes the hashes of models the registry does not pin.
+// It stays Hugging Face when another mirror serves the files, so a wrong
+// or compromised mirror cannot vouch for what it serves.
+var checksumMirror = DefaultModelMirror
+
+// errUnreachable is returned by publishedSHA256 when the checksum mirror
+// cannot be reached at all, as on an offline machine.
+var errUnreachable = errors.New("checksum mirror unreachable")
+
+// FetchModel makes sure m is in ModelDir and returns its path. The file is
+// copied from the bundle or downloaded to a .part file next to it, resuming
+// an earlier partial download, and only renamed into place once its hash
+// matches, so an interrupted run never leaves a model that looks complete.
+// A model found in ModelDir without a verified checksum record is checked
+// the same way and downloaded again when it does not match.
+func FetchModel(m Model, src ModelSource, logger *log.Logger) (string, error) {
+	path := m.Path()
+	mirror := src.Mirror
+	if mirror == "" {
+		mirror = DefaultModelMirror
+	}
+	url := strings.TrimSuffix(mirror, "/") + "/" + m.File
+	checksumURL := strings.TrimSuffix(checksumMirror, "/") + "/" + m.File
+
+	if _, err := os.Stat(path); err == nil {
+		ok, err := verifyExisting(m, path, checksumURL, logger)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			logger.Printf("Model already exists ✅: %s", path)
+			return path, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create model directory: %v", err)
+	}
+
+	part := path + ".part"
+	if src.Bundle != "" {
+		bundled := filepath.Join(src.Bundle, m.File)
+		if _, err := os.Stat(bundled); err == nil {
+			expected := strings.ToLower(m.SHA256)
+			if expected == "" {
+				expected = readChecksum(bundled + ".sha256")
+			}
+			if expected == "" {
+				if expected, err = publishedSHA256(checksumURL); err != nil {
+					return "", fmt.Errorf("no checksum for bundled model %s: add %s.sha256 or pin it in the registry: %v", m.Name, bundled, err)
+				}
+			}
+			logger.Printf("Copying model %s from %s", m.Name, bundled)
+			if err := copyFile(bundled, part); err != nil {
+				_ = os.Remove(part)
+				return "", fmt.Errorf("failed to copy bundled model: %v", err)
+			}
+			return path, finishModel(part, path, expected, logger)
+		}
+		logger.Printf("Model %s is not in bundle %s, downloading", m.Name, src.Bundle)
+	}
+
+	expected := strings.ToLower(m.SHA256)
+	if expected == "" {
+		var err error
+		if expected, err = publishedSHA256(checksumURL); err != nil {
+			return "", fmt.Errorf("no checksum for model %s, refusing an unverified download: %v", m.Name, err)
+		}
+	}
+	logger.Printf("Downloading model %s (about %d MB) from %s", m.Name, m.SizeMB, url)
+
+	// A dropped connection is picked up where it stopped
+	const attempts = 3
+	var err error
+	for i := 1; i <= attempts; i++ {
+		if err = download(url, part, logger); err == nil {
+			return path, finishModel(part, path, expected, logger)
+		}
+		logger.Printf("Model download attempt %d/%d failed: %v", i, attempts, err)
+	}
+	return "", fmt.Errorf("failed to download model %s: %v", m.Name, err)
+}
+
+// download appends the rest of url to part, asking for the bytes past what
+// part already holds.
+func download(url, part string, logger *log.Logger) error {
+	var offset int64
+	if info, err := os.Stat(part); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		logger.Printf("Resuming model download at %d MB", offset>>20)
+		flags |= os.O_APPEND
+	case http.StatusOK:
+		// The server ignored the range; start over
+		flags |= os.O_TRUNC
+	case http.StatusRequestedRangeNotSatisfiable:
+		// part already holds the whole file; the checksum tells
+		return nil
+	default:
+		return fmt.Errorf("bad status downloading model: %s", resp.Status)
+	}
+
+	out, err := os.OpenFile(part, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create model file: %v", err)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to save model: %v", err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to save model: %v", err)
+	}
+	return nil
+}
+
+// publishedSHA256 asks for the hash of url without downloading it. It
+// returns errUnreachable when no connection could be made. Hugging Face stores models with Git LFS, whose ETag is the SHA256 of
+// the content; it sends it on the redirect to its CDN rather than on the
+// file.
+func publishedSHA256(url string) (string, error) {
+	var published string
+	client := &http.Client{CheckRedirect: func(r *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if published == "" {
+			published = reportedSHA256(r.Response.Header)
+		}
+		return nil
+	}}
+	resp, err := client.Head(url)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errUnreachable, err)
+	}
+	resp.Body.Close()
+	if published == "" {
+		published = reportedSHA256(resp.Header)
+	}
+	if published == "" {
+		return "", fmt.Errorf("%s publishes no SHA256 (status %s)", url, resp.Status)
+	}
+	return published, nil
+}
+
+// reportedSHA256 returns the hash Hugging Face sends for files stored with
+// Git LFS, whose ETag is the SHA256 of the content.
+func reportedSHA256(h http.Header) string {
+	for _, key := range []string{"X-Linked-Etag", "Etag"} {
+		tag := strings.Trim(strings.TrimPrefix(h.Get(key), "W/"), `"`)
+		if isSHA256(tag) {
+			return strings.ToLower(tag)
+		}
+	}
+	return ""
+}
+
+func isSHA256(s string) bool {
+	if len(s) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+// finishModel checks the hash of part and moves it to path. A file with the
+// wrong hash is removed, so the next run downloads it from scratch.
+func finishModel(part, path, expected string, logger *log.Logger) error {
+	sum, err := fileSHA256(part)
+	if err != nil {
+		return fmt.Errorf("failed to hash model: %v", err)
+	}
+	if sum != expected {
+		_ = os.Remove(part)
+		return fmt.Errorf("model %s is corrupt: sha256 %s, expected %s", filepath.Base(path), sum, expected)
+	}
+	if err := os.Rename(part, path); err != nil {
+		return fmt.Errorf("failed to move model into place: %v", err)
+	}
+	if err := recordChecksum(path, sum); err != nil {
+		return err
+	}
+	logger.Printf("Model ready ✅: %s", path)
+	return nil
+}
+
+// verifyExisting reports whether the model at path is intact. A model whose
+// checksum record matches its size, and the registry hash if pinned, is
+// trusted without hashing it again. Any other file, such as one downloaded
+// before checksums were kept, is hashed and compared with the pinned or
+// published hash; a mismatching file is removed and false returned. When
+// there is no pin and the published hash cannot be fetched because the
+// machine is offline, the file is used unverified, as it was before
+// checksums were kept, and checked on the next run that has a network.
+func verifyExisting(m Model, path, checksumURL string, logger *log.Logger) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	pinned := strings.ToLower(m.SHA256)
+	recorded, size := readChecksumRecord(path + ".sha256")
+	if recorded != "" && size == info.Size() && (pinned == "" || pinned == recorded) {
+		return true, nil
+	}
+
+	expected := pinned
+	if expected == "" {
+		if expected, err = publishedSHA256(checksumURL); errors.Is(err, errUnreachable) {
+			logger.Printf("[WARN] Cannot verify model %s while offline, using it unverified: %v", path, err)
+			return true, nil
+		} else if err != nil {
+			return false, fmt.Errorf("cannot verify model %s, it has no checksum record: %v", path, err)
+		}
+	}
+	logger.Printf("Verifying model %s", path)
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash model: %v", err)
+	}
+	if sum != expected {
+		logger.Printf("[WARN] Model %s is corrupt (sha256 %s, expected %s), downloading it again", path, sum, expected)
+		if err := os.Remove(path); err != nil {
+			return false, fmt.Errorf("failed to remove corrupt model: %v", err)
+		}
+		_ = os.Remove(path + ".sha256")
+		return false, nil
+	}
+	return true, recordChecksum(path, sum)
+}
+
+// recordChecksum writes "<sha256> <size>" next to a verified model.
+func recordChecksum(path, sum string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	record := fmt.Sprintf("%s %d\n", sum, info.Size())
+	if err := os.WriteFile(path+".sha256", []byte(record), 0644); err != nil {
+		return fmt.Errorf("failed to record model checksum: %v", err)
+	}
+	return nil
+}
+
+// readChecksumRecord reads a record written by recordChecksum. The size is
+// -1 when the record is missing or has none.
+func readChecksumRecord(path string) (string, int64) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", -1
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 || !isSHA256(fields[0]) {
+		return "", -1
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return "", -1
+	}
+	return strings.ToLower(fields[0]), size
+}
+
+// readChecksum returns the hash in a sha256sum style file, or "".
+func readChecksum(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if fields := strings.Fields(string(data)); len(fields) > 0 && isSHA256(fields[0]) {
+		return strings.ToLower(fields[0])
+	}
+	return ""
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// modelServer serves data the way Hugging Face does: /resolve/ redirects
+// with the LFS hash as X-Linked-Etag, and ranges are honoured. /plain/
+// serves the file without any hash, and /evil/ serves other content with
+// a hash that matches it.
+func modelServer(t *testing.T, data []byte) (*httptest.Server, *[]string) {
+	t.Helper()
+	sum := sha256.Sum256(data)
+	evil := bytes.Repeat([]byte("evil"), 1000)
+	evilSum := sha256.Sum256(evil)
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch filepath.Dir(r.URL.Path) {
+		case "/resolve":
+			w.Header().Set("X-Linked-Etag", `"`+hex.EncodeToString(sum[:])+`"`)
+			http.Redirect(w, r, "/cdn/"+filepath.Base(r.URL.Path), http.StatusFound)
+		case "/evil":
+			w.Header().Set("Etag", `"`+hex.EncodeToString(evilSum[:])+`"`)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(evil))
+		default:
+			if r.Method == http.MethodGet {
+				ranges = append(ranges, r.Header.Get("Range"))
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &ranges
+}
+
+func TestFetchModel(t *testing.T) {
+	data := bytes.Repeat([]byte("ggml"), 100000)
+	srv, ranges := modelServer(t, data)
+	logger := log.New(io.Discard, "", 0)
+	m := Model{Name: "tiny", File: "ggml-tiny.bin"}
+	defer func(mirror string) { checksumMirror = mirror }(checksumMirror)
+	checksumMirror = srv.URL + "/resolve"
+
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(ModelDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// An interrupted download is resumed and verified
+	if err := os.WriteFile(m.Path()+".part", data[:1234], 0644); err != nil {
+		t.Fatal(err)
+	}
+	path, err := FetchModel(m, ModelSource{Mirror: srv.URL + "/resolve"}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Fatal("downloaded model differs from the served one")
+	}
+	if len(*ranges) != 1 || (*ranges)[0] != "bytes=1234-" {
+		t.Errorf("requests = %q, want one resuming at 1234", *ranges)
+	}
+
+	// A corrupt model without a checksum record is replaced
+	if err := os.WriteFile(path, data[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(path + ".sha256")
+	if _, err := FetchModel(m, ModelSource{Mirror: srv.URL + "/resolve"}, logger); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Error("corrupt model was kept")
+	}
+
+	// A mirror is checked against the published hash, not its own
+	_ = os.Remove(path)
+	if _, err := FetchModel(m, ModelSource{Mirror: srv.URL + "/evil"}, logger); err == nil {
+		t.Error("model from a mirror with other content was installed")
+	}
+	if _, err := FetchModel(m, ModelSource{Mirror: srv.URL + "/plain"}, logger); err != nil {
+		t.Errorf("model from a mirror without hashes: %v", err)
+	}
+
+	// No download without a hash to check it against
+	_ = os.Remove(path)
+	checksumMirror = srv.URL + "/plain"
+	if _, err := FetchModel(m, ModelSource{Mirror: srv.URL + "/plain"}, logger); err == nil {
+		t.Error("unverifiable download was installed")
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Error("model exists after a refused download")
+	}
+	checksumMirror = srv.URL + "/resolve"
+
+	// A wrong pinned hash is refused
+	pinned := m
+	pinned.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	if _, err := FetchModel(pinned, ModelSource{Mirror: srv.URL + "/plain"}, logger); err == nil {
+		t.Error("model with the wrong hash was installed")
+	}
+
+	// A bundled copy is verified against its .sha256 file
+	bundle := t.TempDir()
+	sum := sha256.Sum256(data)
+	if err := os.WriteFile(filepath.Join(bundle, m.File), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bundle, m.File+".sha256"), []byte(hex.EncodeToString(sum[:])+"  "+m.File+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FetchModel(m, ModelSource{Mirror: srv.URL + "/plain", Bundle: bundle}, logger); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); !bytes.Equal(got, data) {
+		t.Error("bundled model was not installed")
+	}
+}
+
+func TestFetchModelOffline(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	m := Model{Name: "tiny", File: "ggml-tiny.bin"}
+	defer func(mirror string) { checksumMirror = mirror }(checksumMirror)
+
+	// Nothing listens on a closed server's address
+	srv := httptest.NewServer(http.NotFoundHandler())
+	checksumMirror = srv.URL
+	srv.Close()
+
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(ModelDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("model downloaded by an older version")
+	if err := os.WriteFile(m.Path(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A model from before checksum records still loads offline
+	if _, err := FetchModel(m, ModelSource{}, logger); err != nil {
+		t.Fatalf("existing model refused offline: %v", err)
+	}
+	if _, err := os.Stat(m.Path() + ".sha256"); err == nil {
+		t.Error("unverified model got a checksum record")
+	}
+
+	// A pinned hash needs no network and still catches corruption
+	sum := sha256.Sum256(data)
+	pinned := m
+	pinned.SHA256 = hex.EncodeToString(sum[:])
+	if _, err := FetchModel(pinned, ModelSource{}, logger); err != nil {
+		t.Errorf("pinned model refused offline: %v", err)
+	}
+	pinned.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	if _, err := FetchModel(pinned, ModelSource{}, logger); err == nil {
+		t.Error("corrupt pinned model was used")
+	}
+}
+
+func TestCheckLanguage(t *testing.T) {
+	english := Model{Name: "base.en"}
+	multilingual := Model{Name: "base", Multilingual: true}
+	tests := []struct {
+		model     Model
+		language  string
+		translate bool
+		wantErr   bool
+	}{
+		{english, "", false, false},
+		{english, "en", false, false},
+		{english, "auto", false, false},
+		{english, "fr", false, true},
+		{english, "", true, true},
+		{multilingual, "fr", true, false},
+	}
+	for _, tt := range tests {
+		err := tt.model.CheckLanguage(tt.language, tt.translate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s.CheckLanguage(%q, %v) = %v, want error %v", tt.model.Name, tt.language, tt.translate, err, tt.wantErr)
+		}
+	}
+}
@@ -2,9 +2,7 @@ package utils
 
 import (
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -62,49 +60,6 @@ func installWindows() {
 	}
 }
 
-// SetupModel checks if the Whisper model exists, if not downloads it
-func SetupModel() error {
-
-	modelPath := "models/ggml-base.en.bin"
-	if _, err := os.Stat(modelPath); err == nil {
-		fmt.Println("Model already exists ✅:", modelPath)
-		return nil
-	}
-
-	fmt.Println("Model not found, downloading...")
-
-	// Create directory if not exists
-	if err := os.MkdirAll(filepath.Dir(modelPath), os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create model directory: %v", err)
-	}
-
-	url := "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/ggml-base.en.bin"
-	out, err := os.Create(modelPath)
-	if err != nil {
-		return fmt.Errorf("failed to create model file: %v", err)
-	}
-	defer out.Close()
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download model: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("bad status downloading model: %s", resp.Status)
-	}
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to save model: %v", err)
-	}
-
-	fmt.Println("Model downloaded successfully ✅:", modelPath)
-
-	return nil
-}
-
 func SetupWhisper(logger *log.Logger) error {
 
 	repoDir := "whisper.cpp"